@@ -3,7 +3,9 @@ package lexer
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
+	"strings"
 	"unicode"
 )
 
@@ -16,14 +18,16 @@ const (
 	Word
 	Number
 	String
+	Byte
 	Colon
 	Semicolon
 	BracketOpen
 	BracketClose
 	BraceOpen
 	BraceClose
-	ParenOpen
+	MapOpen
 	ParenClose
+	Comment
 	// Keywords
 	Var
 	If
@@ -31,32 +35,83 @@ const (
 	Then
 	For
 	End
+	Step
+	Begin
+	Until
+	While
+	Repeat
+	Leave
+	Exit
+	Recurse
 )
 
+// Pos describes a location in the source. Line and Column start at 1,
+// Column counts runes and Offset counts bytes from the start of input.
+type Pos struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
+}
+
+func (p Pos) String() string {
+	if p.Filename == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+}
+
+// Mode controls optional scanner behaviour.
+type Mode uint
+
+const (
+	// ScanComments makes the scanner emit Comment tokens rather than skip them.
+	ScanComments Mode = 1 << iota
+)
+
+// Error is a lexical error such as an unterminated comment.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("%s: %s", e.Pos, e.Msg) }
+
+// Token is a lexical token. Pos is the location of its first rune and End
+// the location immediately after its last.
 type Token struct {
-	Type     TokenType
-	Value    string
-	Position int
+	Type  TokenType
+	Value string
+	Pos   Pos
+	End   Pos
 }
 
 type Scanner struct {
-	src          *bufio.Reader
-	current      Token
-	buf          *bytes.Buffer
-	position     int
-	lastRuneSize int // there is only ever need to read then unread one rune
-	err          error
+	src     *bufio.Reader
+	current Token
+	buf     *bytes.Buffer
+	pos     Pos
+	last    Pos // position before the last read, there is only ever need to read then unread one rune
+	mode    Mode
+	err     error
 }
 
-func NewScanner(r io.Reader) *Scanner {
+func NewScanner(r io.Reader) *Scanner { return NewFileScanner("", r, 0) }
+
+// NewFileScanner returns a Scanner whose token positions are reported as
+// belonging to filename, scanning according to mode.
+func NewFileScanner(filename string, r io.Reader, mode Mode) *Scanner {
 	s := &Scanner{
-		src: bufio.NewReader(r),
-		buf: bytes.NewBuffer(make([]byte, 0, 1024)),
+		src:  bufio.NewReader(r),
+		buf:  bytes.NewBuffer(make([]byte, 0, 1024)),
+		pos:  Pos{Filename: filename, Line: 1, Column: 1},
+		mode: mode,
 	}
 	s.current = s.next()
 	return s
 }
 
+// Err returns the first error encountered while scanning, other than io.EOF.
 func (s *Scanner) Err() error {
 	if s.err == io.EOF {
 		return nil
@@ -64,6 +119,12 @@ func (s *Scanner) Err() error {
 	return s.err
 }
 
+func (s *Scanner) fail(pos Pos, msg string) {
+	if s.err == nil || s.err == io.EOF {
+		s.err = &Error{Pos: pos, Msg: msg}
+	}
+}
+
 func (s *Scanner) Scan() bool {
 	return s.current.Type != EOF
 }
@@ -75,19 +136,31 @@ func (s *Scanner) Token() Token {
 }
 
 func (s *Scanner) read() rune {
+	s.last = s.pos
 	ch, n, err := s.src.ReadRune()
 	if err != nil {
-		s.err = err
+		if s.err == nil {
+			s.err = err
+		}
 		return eof
 	}
-	s.position += n
-	s.lastRuneSize = n
+	s.pos.Offset += n
+	if ch == '\n' {
+		s.pos.Line++
+		s.pos.Column = 1
+	} else {
+		s.pos.Column++
+	}
 	return ch
 }
 
 func (s *Scanner) unread() {
+	if s.last == s.pos {
+		// nothing was consumed by the last read, i.e. eof
+		return
+	}
 	s.src.UnreadRune()
-	s.position -= s.lastRuneSize
+	s.pos = s.last
 }
 
 func (s *Scanner) peek() rune {
@@ -111,8 +184,9 @@ func (s *Scanner) skipSpace() {
 
 func isWhitespace(ch rune) bool { return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' }
 
-func (s *Scanner) scanWord() Token {
-	start := s.position
+// scanWord scans the rest of a word that began at start, any of which
+// already read is in s.buf.
+func (s *Scanner) scanWord(start Pos) Token {
 	for {
 		ch := s.read()
 		if isWhitespace(ch) || ch == eof {
@@ -125,40 +199,236 @@ func (s *Scanner) scanWord() Token {
 	s.buf.Reset()
 	switch ident {
 	case "var":
-		return Token{Var, ident, start}
+		return s.token(Var, ident, start)
 	case "if":
-		return Token{If, ident, start}
+		return s.token(If, ident, start)
 	case "then":
-		return Token{Then, ident, start}
+		return s.token(Then, ident, start)
 	case "else":
-		return Token{Else, ident, start}
+		return s.token(Else, ident, start)
 	case "for":
-		return Token{For, ident, start}
+		return s.token(For, ident, start)
 	case "end":
-		return Token{End, ident, start}
+		return s.token(End, ident, start)
+	case "step":
+		return s.token(Step, ident, start)
+	case "begin":
+		return s.token(Begin, ident, start)
+	case "until":
+		return s.token(Until, ident, start)
+	case "while":
+		return s.token(While, ident, start)
+	case "repeat":
+		return s.token(Repeat, ident, start)
+	case "leave":
+		return s.token(Leave, ident, start)
+	case "exit":
+		return s.token(Exit, ident, start)
+	case "recurse":
+		return s.token(Recurse, ident, start)
+	}
+	if isNumber(ident) {
+		return s.token(Number, ident, start)
 	}
-	return Token{Word, ident, s.position - len(ident)}
+	return s.token(Word, ident, start)
 }
 
-func (s *Scanner) scanNumber() string {
+// isNumber reports whether a word is a number literal, or a malformed one for
+// the parser to report. That is the case when it starts with a digit, after
+// an optional -, and the leading digits are followed by nothing, by one of
+// . _ e E + -, by a final n or d suffix or, after a single 0, by a base
+// prefix x o or b. Other words starting with digits, like 2dup, are ordinary
+// words.
+func isNumber(ident string) bool {
+	s := strings.TrimPrefix(ident, "-")
+	i := 0
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	if i == 0 {
+		return false
+	}
+	if i == len(s) {
+		return true
+	}
+	switch s[i] {
+	case '.', '_', 'e', 'E', '+', '-':
+		return true
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return s[:i] == "0"
+	case 'n', 'd':
+		return i == len(s)-1
+	}
+	return false
+}
+
+// scanString scans a string opened by a " that has already been read,
+// decoding escape sequences.
+func (s *Scanner) scanString(start Pos) string {
 	for {
 		ch := s.read()
-		if !unicode.IsDigit(ch) && ch != '.' && ch != '-' {
+		if ch == eof {
+			s.fail(start, "unterminated string")
+			break
+		}
+		if ch == '"' {
+			break
+		}
+		if ch == '\\' {
+			s.scanEscape('"')
+			continue
+		}
+		s.buf.WriteRune(ch)
+	}
+	str := s.buf.String()
+	s.buf.Reset()
+	return str
+}
+
+// scanEscape decodes an escape sequence whose \ has already been read.
+// Recognised escapes are \n \r \t \\, the quote character of the literal
+// being scanned, \xNN for the byte with hex value NN and \u{N...} for the
+// unicode code point with hex value N... of up to six digits.
+func (s *Scanner) scanEscape(quote rune) {
+	pos := s.last
+	switch ch := s.read(); ch {
+	case 'n':
+		s.buf.WriteByte('\n')
+	case 'r':
+		s.buf.WriteByte('\r')
+	case 't':
+		s.buf.WriteByte('\t')
+	case quote, '\\':
+		s.buf.WriteRune(ch)
+	case 'x':
+		n, ok := s.scanHex(2, 2)
+		if !ok {
+			s.fail(pos, "invalid \\x escape, expecting two hex digits")
+			return
+		}
+		s.buf.WriteByte(byte(n))
+	case 'u':
+		if s.read() != '{' {
+			s.fail(pos, "invalid \\u escape, expecting {")
+			return
+		}
+		n, ok := s.scanHex(1, 6)
+		if !ok || s.read() != '}' || n > unicode.MaxRune || (n >= 0xD800 && n < 0xE000) {
+			s.fail(pos, "invalid \\u escape, expecting a unicode code point in hex followed by }")
+			return
+		}
+		s.buf.WriteRune(rune(n))
+	case eof:
+		s.unread()
+	default:
+		s.fail(pos, fmt.Sprintf("unknown escape sequence \\%c", ch))
+	}
+}
+
+// scanHex reads between min and max hex digits and returns their value.
+func (s *Scanner) scanHex(min, max int) (int, bool) {
+	var n, i int
+	for ; i < max; i++ {
+		ch := s.read()
+		d := hexDigit(ch)
+		if d < 0 {
 			s.unread()
 			break
 		}
+		n = n*16 + d
+	}
+	return n, i >= min
+}
+
+func hexDigit(ch rune) int {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch-'a') + 10
+	case 'A' <= ch && ch <= 'F':
+		return int(ch-'A') + 10
+	}
+	return -1
+}
+
+// scanByte scans a byte literal opened by a ' that has already been read. It
+// holds a single ASCII character or an escape sequence decoding to one byte.
+func (s *Scanner) scanByte(start Pos) string {
+	switch ch := s.read(); ch {
+	case eof, '\'':
+		s.fail(start, "empty byte literal")
+		return ""
+	case '\\':
+		s.scanEscape('\'')
+	default:
 		s.buf.WriteRune(ch)
 	}
-	ident := s.buf.String()
+	if s.read() != '\'' {
+		s.unread()
+		s.fail(start, "unterminated byte literal")
+	}
+	str := s.buf.String()
 	s.buf.Reset()
+	if len(str) != 1 {
+		s.fail(start, "byte literal must be a single byte, use \\xNN for values above 127")
+		return ""
+	}
+	return str
+}
+
+// scanRawString scans a string opened by a ` that has already been read. The
+// text up to the closing ` is taken verbatim, including any newlines.
+func (s *Scanner) scanRawString(start Pos) string {
+	for {
+		ch := s.read()
+		if ch == eof {
+			s.fail(start, "unterminated raw string")
+			break
+		}
+		if ch == '`' {
+			break
+		}
+		s.buf.WriteRune(ch)
+	}
+	str := s.buf.String()
+	s.buf.Reset()
+	return str
+}
 
-	return ident
+// scanBlockComment scans a comment opened by a ( that has already been read.
+// Parentheses nest so a comment may contain balanced parentheses, including
+// another comment.
+func (s *Scanner) scanBlockComment(start Pos) string {
+	s.buf.WriteRune('(')
+	depth := 1
+	for depth > 0 {
+		ch := s.read()
+		switch ch {
+		case eof:
+			s.fail(start, "unterminated comment")
+			depth = 0
+			continue
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		s.buf.WriteRune(ch)
+	}
+	str := s.buf.String()
+	s.buf.Reset()
+	return str
 }
 
-func (s *Scanner) scanString() string {
+// scanLineComment scans a comment opened by a \ that has already been read,
+// up to but not including the end of the line.
+func (s *Scanner) scanLineComment() string {
+	s.buf.WriteRune('\\')
 	for {
 		ch := s.read()
-		if ch == '"' || ch == eof {
+		if ch == '\n' || ch == eof {
+			s.unread()
 			break
 		}
 		s.buf.WriteRune(ch)
@@ -168,48 +438,72 @@ func (s *Scanner) scanString() string {
 	return str
 }
 
+// token returns a token of the given type that began at start and ends at
+// the current position.
+func (s *Scanner) token(typ TokenType, value string, start Pos) Token {
+	return Token{Type: typ, Value: value, Pos: start, End: s.pos}
+}
+
 func (s *Scanner) next() Token {
+	for {
+		tok := s.scanToken()
+		if tok.Type != Comment || s.mode&ScanComments != 0 {
+			return tok
+		}
+	}
+}
+
+func (s *Scanner) scanToken() Token {
 	s.skipSpace()
 	peek := s.peek()
 	if peek == eof {
-		return Token{Type: EOF}
+		return s.token(EOF, "", s.pos)
 	}
-	start := s.position
+	start := s.pos
 	switch peek {
 	case ':':
 		s.read()
-		return Token{Colon, ":", start}
+		return s.token(Colon, ":", start)
 	case ';':
 		s.read()
-		return Token{Semicolon, ";", start}
+		return s.token(Semicolon, ";", start)
 	case '"':
 		s.read()
-		return Token{String, s.scanString(), start}
+		return s.token(String, s.scanString(start), start)
+	case '\'':
+		s.read()
+		return s.token(Byte, s.scanByte(start), start)
+	case '`':
+		s.read()
+		return s.token(String, s.scanRawString(start), start)
 	case '[':
 		s.read()
-		return Token{BracketOpen, "[", start}
+		return s.token(BracketOpen, "[", start)
 	case ']':
 		s.read()
-		return Token{BracketClose, "]", start}
+		return s.token(BracketClose, "]", start)
 	case '{':
 		s.read()
-		return Token{BraceOpen, "{", start}
+		return s.token(BraceOpen, "{", start)
 	case '}':
 		s.read()
-		return Token{BraceClose, "}", start}
+		return s.token(BraceClose, "}", start)
+	case '#':
+		s.read()
+		if s.peek() == '{' {
+			s.read()
+			return s.token(MapOpen, "#{", start)
+		}
+		s.buf.WriteRune('#')
 	case '(':
 		s.read()
-		return Token{ParenOpen, "(", start}
+		return s.token(Comment, s.scanBlockComment(start), start)
+	case '\\':
+		s.read()
+		return s.token(Comment, s.scanLineComment(), start)
 	case ')':
 		s.read()
-		return Token{ParenOpen, ")", start}
-	}
-	if unicode.IsDigit(peek) || peek == '-' {
-		tok := Token{Number, s.scanNumber(), start}
-		if tok.Value == "-" {
-			tok.Type = Word
-		}
-		return tok
+		return s.token(ParenClose, ")", start)
 	}
-	return s.scanWord()
+	return s.scanWord(start)
 }
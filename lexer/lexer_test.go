@@ -8,7 +8,7 @@ import (
 func newToken(typ TokenType, lit string) Token { return Token{Type: typ, Value: lit} }
 
 func TestScanner(t *testing.T) {
-	const input = `5 -5 5.5 + : square ; "string"	for end if else then { 1 } [ 1 ] -`
+	const input = `5 -5 5.5 + : square ; "string"	for end if else then { 1 } [ 1 ] - step begin until while repeat leave beginning exit recurse #{ # #foo }`
 	scn := NewScanner(strings.NewReader(input))
 	if scn == nil {
 		t.Fatal("scanner should not be nil")
@@ -38,6 +38,19 @@ func TestScanner(t *testing.T) {
 		newToken(Number, "1"),
 		newToken(BracketClose, "]"),
 		newToken(Word, "-"),
+		newToken(Step, "step"),
+		newToken(Begin, "begin"),
+		newToken(Until, "until"),
+		newToken(While, "while"),
+		newToken(Repeat, "repeat"),
+		newToken(Leave, "leave"),
+		newToken(Word, "beginning"),
+		newToken(Exit, "exit"),
+		newToken(Recurse, "recurse"),
+		newToken(MapOpen, "#{"),
+		newToken(Word, "#"),
+		newToken(Word, "#foo"),
+		newToken(BraceClose, "}"),
 	}
 	if len(expected) != len(tokens) {
 		t.Fatalf("expecting %d tokens got %d", len(expected), len(tokens))
@@ -58,7 +71,184 @@ func TestLexUnterminatedString(t *testing.T) {
 	for scn.Scan() {
 		scn.Token()
 	}
-	if scn.Err() != nil {
-		t.Errorf("expecting nil error, got %v", scn.Err())
+	if scn.Err() == nil || scn.Err().Error() != "1:1: unterminated string" {
+		t.Errorf("expecting unterminated string error, got %v", scn.Err())
+	}
+}
+
+func TestScanStringEscapes(t *testing.T) {
+	for i, tt := range []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{`"a\tb\nc\r"`, "a\tb\nc\r", ""},
+		{`"say \"hi\" \\o/"`, `say "hi" \o/`, ""},
+		{`"\x41\xff"`, "A\xff", ""},
+		{`"\u{48}\u{1F600}"`, "H\U0001F600", ""},
+		{"`raw \\n \"quoted\"\nline two`", "raw \\n \"quoted\"\nline two", ""},
+		{`"bad \q"`, "bad ", "1:6: unknown escape sequence \\q"},
+		{`"\x4"`, "", "1:2: invalid \\x escape, expecting two hex digits"},
+		{`"\u{110000}"`, "", "1:2: invalid \\u escape, expecting a unicode code point in hex followed by }"},
+		{"`unterminated", "unterminated", "1:1: unterminated raw string"},
+	} {
+		scn := NewScanner(strings.NewReader(tt.input))
+		tok := scn.Token()
+		if tok.Type != String || tok.Value != tt.expected {
+			t.Errorf("%d. expecting string %q got %q", i, tt.expected, tok.Value)
+		}
+		var err string
+		if scn.Err() != nil {
+			err = scn.Err().Error()
+		}
+		if err != tt.err {
+			t.Errorf("%d. expecting error %q got %q", i, tt.err, err)
+		}
+	}
+}
+
+func TestScannerPosition(t *testing.T) {
+	const input = "5 \"foo\"\n  : bar\n\t-1 ;"
+	scn := NewFileScanner("test.roost", strings.NewReader(input), 0)
+	expected := []Pos{
+		{"test.roost", 0, 1, 1},
+		{"test.roost", 2, 1, 3},
+		{"test.roost", 10, 2, 3},
+		{"test.roost", 12, 2, 5},
+		{"test.roost", 17, 3, 2},
+		{"test.roost", 20, 3, 5},
+	}
+	var i int
+	for ; scn.Scan(); i++ {
+		tok := scn.Token()
+		if i >= len(expected) {
+			continue
+		}
+		if tok.Pos != expected[i] {
+			t.Errorf("%d. %q expecting position %+v got %+v", i, tok.Value, expected[i], tok.Pos)
+		}
+	}
+	if i != len(expected) {
+		t.Fatalf("expecting %d tokens got %d", len(expected), i)
+	}
+	if s := expected[2].String(); s != "test.roost:2:3" {
+		t.Errorf("expecting test.roost:2:3 got %s", s)
+	}
+}
+
+func TestScanComments(t *testing.T) {
+	const input = "1 ( a (nested) comment ) 2 \\ to the end ( of line\n3 \\"
+	for _, tt := range []struct {
+		mode     Mode
+		expected []Token
+	}{
+		{0, []Token{
+			newToken(Number, "1"),
+			newToken(Number, "2"),
+			newToken(Number, "3"),
+		}},
+		{ScanComments, []Token{
+			newToken(Number, "1"),
+			newToken(Comment, "( a (nested) comment )"),
+			newToken(Number, "2"),
+			newToken(Comment, "\\ to the end ( of line"),
+			newToken(Number, "3"),
+			newToken(Comment, "\\"),
+		}},
+	} {
+		scn := NewFileScanner("", strings.NewReader(input), tt.mode)
+		var tokens []Token
+		for scn.Scan() {
+			tokens = append(tokens, scn.Token())
+		}
+		if len(tt.expected) != len(tokens) {
+			t.Fatalf("mode %d: expecting %d tokens got %d", tt.mode, len(tt.expected), len(tokens))
+		}
+		for i, v := range tokens {
+			if v.Type != tt.expected[i].Type || v.Value != tt.expected[i].Value {
+				t.Errorf("mode %d: %d. expecting %q got %q", tt.mode, i, tt.expected[i].Value, v.Value)
+			}
+		}
+		if scn.Err() != nil {
+			t.Errorf("mode %d: expecting nil error, got %v", tt.mode, scn.Err())
+		}
+	}
+}
+
+func TestLexUnterminatedComment(t *testing.T) {
+	const input = "1 2\n ( unterminated ( comment )"
+	scn := NewScanner(strings.NewReader(input))
+	for scn.Scan() {
+		scn.Token()
+	}
+	if scn.Err() == nil || scn.Err().Error() != "2:2: unterminated comment" {
+		t.Errorf("expecting unterminated comment error, got %v", scn.Err())
+	}
+}
+
+func TestScanByte(t *testing.T) {
+	for i, tt := range []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{`'a'`, "a", ""},
+		{`' '`, " ", ""},
+		{`'\''`, "'", ""},
+		{`'\n'`, "\n", ""},
+		{`'\xff'`, "\xff", ""},
+		{`''`, "", "1:1: empty byte literal"},
+		{`'ab'`, "a", "1:1: unterminated byte literal"},
+		{`'é'`, "", "1:1: byte literal must be a single byte, use \\xNN for values above 127"},
+	} {
+		scn := NewScanner(strings.NewReader(tt.input))
+		tok := scn.Token()
+		if tok.Type != Byte || tok.Value != tt.expected {
+			t.Errorf("%d. expecting byte %q got %q", i, tt.expected, tok.Value)
+		}
+		var err string
+		if scn.Err() != nil {
+			err = scn.Err().Error()
+		}
+		if err != tt.err {
+			t.Errorf("%d. expecting error %q got %q", i, tt.err, err)
+		}
+	}
+}
+
+func TestScanNumber(t *testing.T) {
+	const input = `0xFF 0b1010 0o17 1e-9 -2.5E+3 1_000_000 1-2 0xZZ 2dup 2over -foo - 10x 10n 0xFFn 1.50d 2d 2nip`
+	expected := []Token{
+		newToken(Number, "0xFF"),
+		newToken(Number, "0b1010"),
+		newToken(Number, "0o17"),
+		newToken(Number, "1e-9"),
+		newToken(Number, "-2.5E+3"),
+		newToken(Number, "1_000_000"),
+		newToken(Number, "1-2"),
+		newToken(Number, "0xZZ"),
+		newToken(Word, "2dup"),
+		newToken(Word, "2over"),
+		newToken(Word, "-foo"),
+		newToken(Word, "-"),
+		newToken(Word, "10x"),
+		newToken(Number, "10n"),
+		newToken(Number, "0xFFn"),
+		newToken(Number, "1.50d"),
+		newToken(Number, "2d"),
+		newToken(Word, "2nip"),
+	}
+	scn := NewScanner(strings.NewReader(input))
+	var tokens []Token
+	for scn.Scan() {
+		tokens = append(tokens, scn.Token())
+	}
+	if len(expected) != len(tokens) {
+		t.Fatalf("expecting %d tokens got %d", len(expected), len(tokens))
+	}
+	for i, v := range tokens {
+		if v.Type != expected[i].Type || v.Value != expected[i].Value {
+			t.Errorf("%d. expecting %d %q got %d %q", i, expected[i].Type, expected[i].Value, v.Type, v.Value)
+		}
 	}
 }
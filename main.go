@@ -13,6 +13,9 @@ import (
 )
 
 func main() {
+	if len(os.Args) == 3 && os.Args[1] == "check" {
+		os.Exit(check(os.Args[2]))
+	}
 	var input io.ReadCloser
 	if len(os.Args) < 2 {
 		input = os.Stdin
@@ -24,15 +27,17 @@ func main() {
 		input = file
 	}
 	defer input.Close()
-	env := runtime.New(1024)
+	env := runtime.New(runtime.DefaultStackLimit)
 	var p *parser.Parser
 	if len(os.Args) >= 2 {
-		p = parser.New(input)
+		p = parser.NewFile(os.Args[1], input)
 		ast, err := p.Parse()
 		if err != nil {
 			log.Fatal(err)
 		}
-		parser.Eval(env, ast)
+		if err := parser.Eval(env, ast); err != nil {
+			log.Fatal(err)
+		}
 		return
 	}
 
@@ -45,11 +50,32 @@ func main() {
 		ast, err := p.Parse()
 		if err != nil {
 			log.Print(err)
+		} else if err := parser.Eval(env, ast); err != nil {
+			log.Print(err)
 		}
-		parser.Eval(env, ast)
 		fmt.Printf("\nrepl> ")
 	}
 	if scanner.Err() != nil {
 		fmt.Fprintf(os.Stderr, "%s", scanner.Err())
 	}
 }
+
+// check parses and resolves the script at path without running it, printing
+// any errors found, and returns the exit status.
+func check(path string) int {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("unable to open source: %s", err)
+	}
+	defer file.Close()
+	ast, err := parser.NewFile(path, file).Parse()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := parser.Resolve(runtime.New(runtime.DefaultStackLimit), ast); err != nil {
+		fmt.Fprintln(os.Stderr, err.(parser.ErrorList).String())
+		return 1
+	}
+	return 0
+}
@@ -2,11 +2,15 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/bruston/roost/parser"
 	"github.com/bruston/roost/runtime"
+	"github.com/bruston/roost/types"
 )
 
 func TestEndToEnd(t *testing.T) {
@@ -30,7 +34,116 @@ func TestEndToEnd(t *testing.T) {
 		{`{ "foo" } "bar" insert 0 # . 1 # .`, "foobar", nil},
 		{`1 0 = if "foo" else "bar" then .`, "bar", nil},
 		{`var foo "bar" ! "foo" foo @ .`, "bar", nil},
+		{"0xFF . 0b1010 . 0o17 . -0x10 .", "2551015-16", nil},
+		{"1e3 . 2.5e-1 . 1_000_000 .", "10000.251000000", nil},
+		{"1 ( one ( nested ) ) 2 + \\ add them\n.", "3", nil},
+		{`"\"quoted\"\t\u{263A}\n" .`, "\"quoted\"\t\u263A\n", nil},
+		{"`raw\\n` .", `raw\n`, nil},
+		{`'a' .`, "a", nil},
+		{`'a' '\x01' + .`, "b", nil},
+		{`'\xff' '\x02' + byte>num .`, "1", nil},
+		{`'\x00' '\x01' - byte>num .`, "255", nil},
+		{`'a' 'b' < .`, "true", nil},
+		{`'a' 97 >byte = .`, "true", nil},
+		{`'a' '\x00' / .`, "", runtime.ErrDivisionByZero},
+		{"7 2 / . 7.0 2 / . 7 2.0 % .", "33.51", nil},
+		{"5.5 2 % . 9223372036854775807 1 + .", "1.5-9223372036854775808", nil},
+		{"1 1.0 = . 2 1.5 > .", "truetrue", nil},
+		{"0b1100 0b1010 and . 0b1100 0b1010 or . 0b1100 0b1010 xor . 0 not .", "8146-1", nil},
+		{"1 4 << . -16 2 >> . '\\x0f' '\\xf0' or byte>num .", "16-4255", nil},
+		{"true false or . true false and . true not .", "truefalsefalse", nil},
+		{"9223372036854775807n 1 + .", "9223372036854775808", nil},
+		{"0xFFFFFFFFFFFFFFFFFFn 1n + . -170_141_183_460_469_231_731_687_303_715_884_105_728n 2 / .", "4722366482869645213696-85070591730234615865843651857942052864", nil},
+		{"100000000000000000000n 7 % . 2n 64 << .", "236893488147419103232", nil},
+		{"1n 1048576 << 1048576 >> . 1n 9999999999 >> .", "10", nil},
+		{"0.10d 0.20d + . 1.5d 2 * . 10.00d 4 / . 1d 3 / .", "0.303.02.500.3333333333333333", nil},
+		{"10.00d 3 / 2 round . 2.675d 2 round . 2.665d 2 round .", "3.332.682.66", nil},
+		{`2.665d "half-up" rounding 2 round . -2.665d "floor" rounding 2 round .`, "2.67-2.67", nil},
+		{`-2.5d "half-even" rounding 0 round . "up" rounding 1.01d 1 round . "down" rounding -1.09d 1 round .`, "-21.1-1.0", nil},
+		{"0.1d 0.1 < . 1n 1.0d = . 2.50d 2.5 = . 3n 2 > .", "truetruetruetrue", nil},
+		{`5 >bigint 2 * . 0.1 >decimal 3 * . "12.345" >decimal 1 round . 7.5d >bigint .`, "100.312.38", nil},
+		{"1d 0d /", "", runtime.ErrDivisionByZero},
+		{"1 2 over . . . 1 2 3 rot . . . 1 2 3 -rot . . .", "121132213", nil},
+		{"1 2 nip . depth . 1 2 tuck . . . depth .", "202120", nil},
+		{"10 20 30 2 pick . 0 pick . 10 20 30 2 roll . . . 1 2 3 0 roll . 1 roll . .", "1030103020312", nil},
+		{"1 2 2dup . . . . 1 2 3 4 2swap . . . . 1 2 3 4 2over . . . . . . 1 2 3 2drop . depth .", "2121214321432110", nil},
+		{"1 2 3 clear depth . 4 .", "04", nil},
+		{"1 2 rot", "", runtime.ErrStackError},
+		{"1 2 3 3 pick", "", runtime.ErrStackError},
+		{"1 2 >r 3 + r> . . 5 >r r@ r> + .", "2410", nil},
+		{"3 0 for 2 0 for J I + . end end", "011223", nil},
+		{"2 0 for 2 0 for 2 0 for K . J . I . end end end", "000001010011100101110111", nil},
+		{": under >r 1 + r> ; 1 2 under . .", "22", nil},
+		{"2 0 for end r>", "", runtime.ErrStackError},
+		{"r@", "", runtime.ErrStackError},
+		{"0 0 for I . end 3 5 for I . end 2 -2 for I . end", "-2-101", nil},
+		{"0 10 -3 step I . end 10 0 5 step I . end 1 0 0.5 step I . end", "107410500.5", nil},
+		{"5 begin dup . 1 - dup 0 = until drop", "54321", nil},
+		{"0 begin dup 3 < while dup . 1 + repeat .", "0123", nil},
+		{"0 begin false while 1 + repeat .", "0", nil},
+		{"10 0 for I 3 = if leave then I . end depth .", "0120", nil},
+		{"3 0 for 3 0 for I 1 = if leave then J . I . end end", "001020", nil},
+		{"0 begin 1 + dup 4 = if leave then false until . 0 begin dup 2 < while 1 + dup 1 = if leave then repeat .", "41", nil},
+		{": count 0 begin 1 + dup 3 = if leave then dup . false until . ; count", "123", nil},
+		{"1 0 0 step end", "", runtime.ErrZeroStep},
+		{": sign dup 0 < if drop -1 exit then 0 > if 1 exit then 0 ; -5 sign . 0 sign . 7 sign .", "-101", nil},
+		{": fact dup 1 > if dup 1 - recurse * then ; 5 fact .", "120", nil},
+		{": find 10 0 for I 3 = if I exit then end -1 ; find . depth .", "30", nil},
+		{": halve begin dup 1 = if exit then 2 / false until ; 64 halve .", "1", nil},
+		{"1 . exit 2 .", "1", nil},
+		{": count dup 0 = if exit then 1 - recurse ; 200000 count .", "0", nil},
+		{": even? dup 0 = if drop true else 1 - odd? then ; : odd? dup 0 = if drop false else 1 - even? then ; 200001 even? .", "false", nil},
+		{"5 [ 1 + ] call . : twice dup >r call r> call ; 3 [ 2 * ] twice .", "612", nil},
+		{"var sq [ dup * ] ! 7 sq @ call . { [ 1 ] [ 2 ] } 1 # call .", "492", nil},
+		{"[ 1 [ 2 ] call + ] call . 5 [ dup 0 = if exit then 1 - ] call .", "34", nil},
+		{"3 0 for [ I ] call . end depth .", "0120", nil},
+		{`[ 1 + "x" 2.0 '\'' { 1 } if 3 else 4 then [ ] 5 0 for I end ] .`, `[ 1 + "x" 2.0 '\'' { 1 } if 3 else 4 then [ ] 5 0 for I end ]`, nil},
+		{`[ "a\"\\\n\r\t\x07\u{85}\xff é😀" ] .`, `[ "a\"\\\n\r\t\x07\u{85}\xff é😀" ]`, nil},
+		{"{ 1 2 3 } [ . ] each { 1 2 3 } [ dup * ] map [ . ] each { } [ . ] each", "123149", nil},
+		{`{ 1 2 3 4 } [ 2 % 0 = ] filter [ . ] each "hello" [ "l" = not ] filter . "héllo" [ . "-" . ] each`, "24heoh-é-l-l-o-", nil},
+		{`{ 1 2 3 4 } 0 [ + ] reduce . "abc" "" [ swap + ] reduce . { } 7 [ + ] reduce .`, "10cba7", nil},
+		{"{ 1 2 3 } [ 2 > ] any . { 1 2 3 } [ 5 > ] any . { } [ 5 > ] any .", "truefalsefalse", nil},
+		{"{ 1 2 3 } [ 0 > ] all . { 1 2 3 } [ 1 > ] all . { } [ 5 > ] all .", "truefalsetrue", nil},
+		{"{ 1 5 3 7 } [ 2 > ] find . . { 1 2 } [ 5 > ] find . depth .", "true5false0", nil},
+		{`{ 3 1 2 } [ ] sort-by [ . ] each { "bb" "a" "ccc" } [ len swap drop 0 swap - ] sort-by [ . ] each "cab" [ ] sort-by .`, "123cccbbaabc", nil},
+		{`{ { "b" 1 } { "a" 1 } { "c" 0 } } [ 1 # swap drop ] sort-by [ 0 # . drop ] each`, "cba", nil},
+		{`#{ "a" 1 "b" { 2 } } . #{ } len . drop`, "#{ a 1 b { 2 } }0", nil},
+		{`#{ "a" 1 } "b" 2 put "a" 3 put keys [ . ] each values [ . ] each len .`, "ab322", nil},
+		{`#{ 1 "one" 0.5 "half" } 1.0 get . 1d has . 0.50d get . "1" has . drop`, "onetruehalffalse", nil},
+		{`#{ "a" 1 "b" 2 "c" 3 } "b" delete "b" 2 put "x" delete keys [ . ] each "a" # .`, "acb1", nil},
+		{`#{ "a" 1 "b" 2 } [ 0 # . 1 # . drop ] each`, "a1b2", nil},
+		{`#{ "a" 1 "b" 2 } dup [ . "a" delete "c" 3 put ] each .`, "{ a 1 }{ b 2 }#{ b 2 c 3 }", nil},
+		{`{ } dup dup insert . #{ "a" 1 } dup "self" swap put . { 1 } dup { } swap insert swap insert .`, "{ <cycle> }#{ a 1 self <cycle> }{ { 1 } { 1 } }", nil},
+		{`#{ "a" 1 "b" 2 "c" 3 } [ 1 # swap drop 1 > ] filter . #{ "a" 1 "b" 3 "c" 2 } [ 1 # swap drop 0 swap - ] sort-by .`, "#{ b 2 c 3 }#{ b 3 c 2 a 1 }", nil},
+		{`{ 1 { 2 "a" } } { 1.0 { 2 "a" } } = . { 1 2 } { 1 2 3 } = . { 1 2 } { 1 2 } <> . 1 "1" = . 1 "1" <> .`, "truefalsefalsefalsetrue", nil},
+		{`{ 1 2 } { 1 3 } < . { 1 2 } { 1 } > . "a" "b" <= . 'a' 'a' >= . false true < . 2 2.5 >= .`, "truetruetruetruetruefalse", nil},
+		{`#{ "a" 1 "b" 2 } #{ "b" 2 "a" 1.0 } = . #{ "a" 1 } #{ "a" 2 } = . #{ "a" { 1 } } #{ "a" { 1 } } = .`, "truefalsetrue", nil},
+		{`{ { 2 1 } { 1 5 } { 1 2 } { 1 } } [ ] sort-by .`, "{ { 1 } { 1 2 } { 1 5 } { 2 1 } }", nil},
+		{`"héllo" len . 1 # . { 1 3 } # . drop`, "5éél", nil},
+		{`"hello world" 6 11 substring . "héllo" "llo" index-of . "abc" "z" index-of .`, "world2-1", nil},
+		{`"a,b,c" "," split len . "-" join . "ab" "" split .`, "3a-b-c{ a b }", nil},
+		{`"  Hi There  " trim upper . "ABC" lower . "a-b-a" "a" "x" replace . "ab" 3 replicate .`, "HI THEREabcx-b-xababab", nil},
+		{`"" 1 62 << replicate len . "ab" 1 25 << replicate len .`, "067108864", nil},
+		{`"roost" "ro" starts-with? . "roost" "st" ends-with? . "roost" "oo" contains? . "roost" "x" contains? .`, "truetruetruefalse", nil},
+		{`"héllo" reverse . { 1 2 3 } reverse . "" reverse len .`, "olléh{ 3 2 1 }0", nil},
+		{`"%s has %d items costing %.2f (%5.1f%%)" { "cart" 3 1.5d 12.25 } format .`, "cart has 3 items costing 1.50 ( 12.2%)", nil},
+		{`"%x %08b %-4s|%c %X" { 255 5 "ab" 'A' "hi" } format .`, "ff 00000101 ab  |A 6869", nil},
+		{`"%q %v %08.3f|%+.1f" { "hi" { 1 2 } -2.5d 2.25d } format .`, `"hi" { 1 2 } -002.500|+2.2`, nil},
+		{`3.14159 2 fixed . 7 3 fixed . 2.345d 2 fixed .`, "3.147.0002.34", nil},
+		{`255 16 radix . -5 2 radix . 0xFFn 36 radix .`, "ff-10173", nil},
+		{`1 "a" { 2 } .s depth .`, "<3> 1 a { 2 }3", nil},
+		{`"hi" >blob . 1 "hi" >blob { 2 } .s`, "<blob><3> 1 <blob> { 2 }", nil},
+		{`5 1 radix`, "", runtime.ErrBase},
+		{`"42" >num 1 + . " -4.5e1 " >num . "0xff" >num . 'a' >num . "42" >num type . "4.2" >num type .`, "43-4525597intnum", nil},
+		{`42 >str "!" + . { 1 "a" } >str len . drop "hi" >blob >str . 1.5d >str .`, "42!7hi1.5", nil},
+		{`"true" >bool . "false" >bool . 0 >bool . 2.5 >bool . '\x00' >bool .`, "truefalsefalsetruefalse", nil},
+		{`{ 104 'i' } >blob >str . "héllo" >slice len . drop #{ "a" 1 } >slice . 'x' >blob len . drop`, "hi5{ { a 1 } }1", nil},
+		{`1 type . 1.5 type . 1n type . 1d type . "a" type . 'a' type . true type . { } type . #{ } type . [ ] type .`, "intnumbigintdecimalstringbyteboolslicemapquotation", nil},
+		{`1 is-num? . 1.5d is-num? . "1" is-num? . 1 is-float? . 1.5 is-float? . { } is-slice? . [ ] is-quotation? .`, "truetruefalsefalsetruetruetrue", nil},
+		{`"x" "rw" open-mode`, "", runtime.ErrFileMode},
 		{`.`, "", runtime.ErrStackError},
+		{`1 0 / .`, "", runtime.ErrDivisionByZero},
+		{`5 0 % .`, "", runtime.ErrDivisionByZero},
 	} {
 		p := parser.New(strings.NewReader(tt.code))
 		ast, err := p.Parse()
@@ -41,7 +154,7 @@ func TestEndToEnd(t *testing.T) {
 		env := runtime.New(1024)
 		buf := &bytes.Buffer{}
 		env.Stdout = buf
-		if err := parser.Eval(env, ast); err != tt.err {
+		if err := parser.Eval(env, ast); !errors.Is(err, tt.err) {
 			t.Errorf("%d. code %s\nshould produce error: %v but received: %v", i, tt.code, tt.err, err)
 		}
 		if buf.String() != tt.expected {
@@ -49,3 +162,574 @@ func TestEndToEnd(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorPosition(t *testing.T) {
+	for i, tt := range []struct {
+		code     string
+		parseErr bool
+		expected string
+	}{
+		{"1 2 +\n  drop .", false, "test.roost:2:8: .: stack underflow"},
+		{": foo\n\t. ;\nfoo", false, "test.roost:2:2: .: stack underflow\n\tin foo called at test.roost:3:1"},
+		{"1 1 = if\n \"foo\" .", true, "test.roost:1:7: if: unterminated at end of input"},
+		{"1 2 +\n\n end", true, "test.roost:3:2: end: unexpected end"},
+		{"var\n 5", true, "test.roost:2:2: 5: expecting word after var"},
+		{"1 2\n 1-2 .", true, "test.roost:2:2: 1-2: malformed number"},
+		{"0xZZ", true, "test.roost:1:1: 0xZZ: malformed number"},
+		{"1__0", true, "test.roost:1:1: 1__0: malformed number"},
+		{": leak\n\t1 >r ;\nleak", false, "test.roost:3:1: leak: unbalanced return stack: 1 values left"},
+		{"1 begin 1 + end", true, "test.roost:1:13: end: unexpected end, expecting until or repeat"},
+		{"1 if until", true, "test.roost:1:6: until: expecting until to close begin"},
+		{"begin 1 repeat", true, "test.roost:1:9: repeat: expecting repeat to close begin ... while"},
+		{"while", true, "test.roost:1:1: while: expecting while to be inside begin"},
+		{": foo leave ;", true, "test.roost:1:7: leave: leave outside of loop"},
+		{"3 0 for : foo leave ; end", true, "test.roost:1:15: leave: leave outside of loop"},
+		{"begin 1 while", true, "test.roost:1:9: while: unterminated at end of input"},
+		{"begin 1 until", false, "test.roost:1:1: begin: type mismatch: expected bool, got int"},
+		{"1 if 2 . then", false, "test.roost:1:3: if: type mismatch: expected bool, got int"},
+		{`"x" if 2 . else 3 . then`, false, "test.roost:1:5: if: type mismatch: expected bool, got string"},
+		{"var x x @ if 2 . then", false, "test.roost:1:11: if: type mismatch: expected bool, got nil"},
+		{": a\n\t. ;\n: b a ;\nb", false, "test.roost:2:2: .: stack underflow\n\tin a called at test.roost:3:5\n\tin b called at test.roost:4:1"},
+		{": a 1 - dup 0 = if drop . then a ;\n3 a", false, "test.roost:1:25: .: stack underflow\n\tin a called at test.roost:1:32\n\tin a called at test.roost:2:3"},
+		{": a 1 - dup 0 = if drop . then a 0 + ;\n3 a", false, "test.roost:1:25: .: stack underflow\n\tin a called at test.roost:1:32 (2 times)\n\tin a called at test.roost:2:3"},
+		{"1 recurse", true, "test.roost:1:3: recurse: recurse outside of word definition"},
+		{"[ . ] call", false, "test.roost:1:3: .: stack underflow\n\tin call called at test.roost:1:7"},
+		{"{ 1 ]", true, "test.roost:1:5: ]: unexpected ]"},
+		{"[ 1 }", true, "test.roost:1:5: }: unexpected }"},
+		{"[ 1 2 end", true, "test.roost:1:7: end: unexpected end, expecting ]"},
+		{"1 if 2 end .", true, "test.roost:1:8: end: unexpected end, expecting then"},
+		{"{ 1 2 then .", true, "test.roost:1:7: then: unexpected then, expecting }"},
+		{": foo 1 if 2 ;", true, "test.roost:1:14: ;: unexpected ;, expecting then"},
+		{"3 0 for 1 then", true, "test.roost:1:11: then: unexpected then, expecting end"},
+		{"1 if 2 repeat", true, "test.roost:1:8: repeat: expecting repeat to close begin ... while"},
+		{"then", true, "test.roost:1:1: then: unexpected then"},
+		{`#{ "a" 1 "b" }`, true, "test.roost:1:14: }: map literal has a key without a value"},
+		{`#{ "a" 1 foo 2 }`, false, "test.roost:1:10: foo: map key must be a literal"},
+		{`#{ "a" foo }`, false, "test.roost:1:8: foo: map value must be a literal"},
+		{"{ 1 { foo } }", false, "test.roost:1:7: foo: slice element must be a literal"},
+		{"1e400", true, "test.roost:1:1: 1e400: number out of range"},
+		{"1.5n", true, "test.roost:1:1: 1.5n: malformed number"},
+		{"1__0d", true, "test.roost:1:1: 1__0d: malformed number"},
+		{`"\q" end`, true, "test.roost:1:2: unknown escape sequence \\q"},
+		{`"\q" 1__0`, true, "test.roost:1:2: unknown escape sequence \\q"},
+		{`end "\q"`, true, "test.roost:1:1: end: unexpected end"},
+	} {
+		p := parser.NewFile("test.roost", strings.NewReader(tt.code))
+		ast, err := p.Parse()
+		if !tt.parseErr {
+			if err != nil {
+				t.Errorf("%d. error parsing: %s\n%s", i, tt.code, err)
+				continue
+			}
+			env := runtime.New(1024)
+			env.Stdout = &bytes.Buffer{}
+			err = parser.Eval(env, ast)
+		}
+		if err == nil {
+			t.Errorf("%d. code %s\nshould produce error: %s", i, tt.code, tt.expected)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%d. code %s\nexpecting error: %s\nbut received: %s", i, tt.code, tt.expected, err)
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	for i, tt := range []struct {
+		code  string
+		check func(error) bool
+	}{
+		{`"a" 1 +`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueInt && e.Expected[0] == types.ValueString
+		}},
+		{`var x x @ 1 +`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueNil
+		}},
+		{`var x x @ 1 <`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueNil
+		}},
+		{`var x "x" x @ <`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueNil && e.Expected[0] == types.ValueString
+		}},
+		{`var x stdin x @ send`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueNil
+		}},
+		{`true 1 -`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueBool
+		}},
+		{`1 +`, func(err error) bool {
+			var e *runtime.StackUnderflowError
+			return errors.As(err, &e)
+		}},
+		{`1 2 3 2over`, func(err error) bool {
+			var e *runtime.StackUnderflowError
+			return errors.As(err, &e)
+		}},
+		{`1 2 -1 pick`, func(err error) bool {
+			var e *runtime.IndexError
+			return errors.As(err, &e) && e.Index == -1
+		}},
+		{`1 2 "1" roll`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueString
+		}},
+		{`{ 1 2 } 2 #`, func(err error) bool {
+			var e *runtime.IndexError
+			return errors.As(err, &e) && e.Index == 2 && e.Len == 2
+		}},
+		{`1 dpu`, func(err error) bool {
+			var e *runtime.UndefinedWordError
+			return errors.As(err, &e) && e.Word == "dpu"
+		}},
+		{`'a' 1 +`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueInt && e.Expected[0] == types.ValueByte
+		}},
+		{`1.5 1 and`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueNum && e.Expected[0] == types.ValueInt
+		}},
+		{`1 -1 <<`, func(err error) bool {
+			return errors.Is(err, runtime.ErrNegativeShift)
+		}},
+		{`1.5d 2000000000 fixed`, func(err error) bool {
+			return errors.Is(err, runtime.ErrTooManyPlaces)
+		}},
+		{`1.5 2000000000 fixed`, func(err error) bool {
+			return errors.Is(err, runtime.ErrTooManyPlaces)
+		}},
+		{`1d 50000000 round`, func(err error) bool {
+			return errors.Is(err, runtime.ErrTooManyPlaces)
+		}},
+		{`1n 9999999999 <<`, func(err error) bool {
+			return errors.Is(err, runtime.ErrShiftTooLarge)
+		}},
+		{`1.5d 1.5 +`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueNum
+		}},
+		{`1.5 10n *`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueNum
+		}},
+		{`1.5d 1 and`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueDecimal
+		}},
+		{`"1.2.3" >decimal`, func(err error) bool {
+			var e *runtime.ConversionError
+			return errors.As(err, &e) && e.To == types.ValueDecimal
+		}},
+		{`256 >byte`, func(err error) bool {
+			var e *runtime.ConversionError
+			return errors.As(err, &e) && e.To == types.ValueByte
+		}},
+		{`: leak 1 >r ; leak`, func(err error) bool {
+			var e *runtime.ReturnStackError
+			return errors.As(err, &e) && e.Delta == 1
+		}},
+		{`: steal r> drop ; 1 >r steal`, func(err error) bool {
+			var e *runtime.ReturnStackError
+			return errors.As(err, &e) && e.Delta == -1
+		}},
+		{`2 0 for I >r end`, func(err error) bool {
+			var e *runtime.ReturnStackError
+			return errors.As(err, &e) && e.Delta == 1
+		}},
+		{`: deep 1 + deep 0 + ; 0 deep`, func(err error) bool {
+			var e *runtime.StackOverflowError
+			return errors.As(err, &e) && e.Depth == runtime.DefaultMaxCallDepth
+		}},
+		{`1 call`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueInt && e.Expected[0] == types.ValueQuotation
+		}},
+		{`5 [ . ] each`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueInt
+		}},
+		{`{ 1 } 5 each`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueInt && e.Expected[0] == types.ValueQuotation
+		}},
+		{`{ 1 } [ 1 + ] filter`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueInt && e.Expected[0] == types.ValueBool
+		}},
+		{`{ 1 "a" } [ ] sort-by`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e)
+		}},
+		{`#{ "a" 1 } "z" get`, func(err error) bool {
+			var e *runtime.KeyError
+			return errors.As(err, &e) && e.Key == "z"
+		}},
+		{`#{ "a" 1 } { } 1 put`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueSlice
+		}},
+		{`#{ { 1 } 2 }`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueSlice
+		}},
+		{`1 "a" has`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueInt && e.Expected[0] == types.ValueMap
+		}},
+		{`1 "a" <`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueString && e.Expected[0] == types.ValueInt
+		}},
+		{`{ 1 { 2 } } { 1 { "a" } } >=`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueString && e.Expected[0] == types.ValueInt
+		}},
+		{`#{ } #{ } <`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueMap
+		}},
+		{`"héllo" 2 6 substring`, func(err error) bool {
+			var e *runtime.IndexError
+			return errors.As(err, &e) && e.Index == 6 && e.Len == 5
+		}},
+		{`{ "a" 1 } "," join`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueInt && e.Expected[0] == types.ValueString
+		}},
+		{`"ab" 1 40 << replicate`, func(err error) bool {
+			return errors.Is(err, runtime.ErrStringTooLong)
+		}},
+		{`"ab" 1 62 << replicate`, func(err error) bool {
+			return errors.Is(err, runtime.ErrStringTooLong)
+		}},
+		{`"a" -1 replicate`, func(err error) bool {
+			var e *runtime.IndexError
+			return errors.As(err, &e) && e.Index == -1
+		}},
+		{`"%.2000000000f" { 1.5d } format`, func(err error) bool {
+			var e *runtime.FormatError
+			return errors.As(err, &e) && e.Reason == "width or precision too large in %.2000000000f"
+		}},
+		{`"%99999999999999999999d" { 1 } format`, func(err error) bool {
+			var e *runtime.FormatError
+			return errors.As(err, &e) && e.Reason == "width or precision too large in %99999999999999999999d"
+		}},
+		{`"%d %d" { 1 } format`, func(err error) bool {
+			var e *runtime.FormatError
+			return errors.As(err, &e) && e.Reason == "missing argument for %d"
+		}},
+		{`"%d" { 1 2 } format`, func(err error) bool {
+			var e *runtime.FormatError
+			return errors.As(err, &e) && e.Reason == "too many arguments, 1 unused"
+		}},
+		{`"%z" { 1 } format`, func(err error) bool {
+			var e *runtime.FormatError
+			return errors.As(err, &e) && e.Reason == "unknown verb %z"
+		}},
+		{`"%d" { "a" } format`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueString
+		}},
+		{`"12abc" >num`, func(err error) bool {
+			var e *runtime.ConversionError
+			return errors.As(err, &e) && e.Value == `"12abc"` && e.To == types.ValueNum
+		}},
+		{`"NaN" >num`, func(err error) bool {
+			var e *runtime.ConversionError
+			return errors.As(err, &e) && e.To == types.ValueNum
+		}},
+		{`"yes" >bool`, func(err error) bool {
+			var e *runtime.ConversionError
+			return errors.As(err, &e) && e.To == types.ValueBool
+		}},
+		{`{ 256 } >blob`, func(err error) bool {
+			var e *runtime.ConversionError
+			return errors.As(err, &e) && e.Value == "256" && e.To == types.ValueByte
+		}},
+		{`{ } >num`, func(err error) bool {
+			var e *runtime.TypeError
+			return errors.As(err, &e) && e.Actual == types.ValueSlice
+		}},
+		{`1 2 3 4 5`, func(err error) bool {
+			var e *runtime.StackOverflowError
+			return errors.As(err, &e) && e.Depth == 4 && errors.Is(err, runtime.ErrStackError)
+		}},
+	} {
+		p := parser.New(strings.NewReader(tt.code))
+		ast, err := p.Parse()
+		if err != nil {
+			t.Errorf("%d. error parsing: %s\n%s", i, tt.code, err)
+			continue
+		}
+		env := runtime.New(4)
+		env.Stdout = &bytes.Buffer{}
+		if err := parser.Eval(env, ast); !tt.check(err) {
+			t.Errorf("%d. code %s\nproduced unexpected error: %v", i, tt.code, err)
+		}
+	}
+}
+
+func TestIterateBlob(t *testing.T) {
+	const code = `[ . ] each [ 'b' > ] filter [ . ] each [ 'b' = ] find . . [ byte>num 0 swap - ] sort-by [ . ] each`
+	ast, err := parser.New(strings.NewReader(code)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := runtime.New(1024)
+	buf := &bytes.Buffer{}
+	env.Stdout = buf
+	for i := 0; i < 4; i++ {
+		env.Stack.PushBlob([]byte("cab"))
+	}
+	if err := parser.Eval(env, ast); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "cabctruebcba"; buf.String() != expected {
+		t.Errorf("expected output %s but received: %s", expected, buf.String())
+	}
+}
+
+func TestCompareBlob(t *testing.T) {
+	const code = `= . <> . < . >= .`
+	ast, err := parser.New(strings.NewReader(code)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := runtime.New(1024)
+	buf := &bytes.Buffer{}
+	env.Stdout = buf
+	for _, b := range []string{"ab", "abc", "ab", "b", "cab", "cab", "cab", "cab"} {
+		env.Stack.PushBlob([]byte(b))
+	}
+	if err := parser.Eval(env, ast); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "truefalsetruefalse"; buf.String() != expected {
+		t.Errorf("expected output %s but received: %s", expected, buf.String())
+	}
+}
+
+func TestSearchNil(t *testing.T) {
+	const code = `[ type "nil" = ] find . type . [ is-int? ] all . [ type "nil" = ] any .`
+	ast, err := parser.New(strings.NewReader(code)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := runtime.New(1024)
+	buf := &bytes.Buffer{}
+	env.Stdout = buf
+	for i := 0; i < 3; i++ {
+		env.Stack.Push(&types.SliceValue{types.ValueSlice, []types.Value{types.NewInt(1), nil}})
+	}
+	if err := parser.Eval(env, ast); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "truenilfalsetrue"; buf.String() != expected {
+		t.Errorf("expected output %s but received: %s", expected, buf.String())
+	}
+}
+
+func TestPipeRead(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "lines.txt")
+	if err := os.WriteFile(name, []byte("one\r\ntwo\nthree"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range []struct {
+		code     string
+		expected string
+	}{
+		{`open drop read-line drop . read-line drop . 2 read-n drop >str . 10 recv drop >str . read-line . 1 recv . read-all drop len . drop close .`, "onetwothree-1-100"},
+		{`open drop 100 read-n drop >str . 1 read-n . read-line . close .`, "one\r\ntwo\nthree-1-10"},
+		{`open drop 1 60 << read-n drop len . drop 1 45 << recv . close .`, "14-10"},
+		{`open drop 1 45 << recv drop len . drop close .`, "140"},
+		{`open drop "x" send . drop close .`, "10"},
+		{`"-missing" + open . drop depth .`, "10"},
+	} {
+		ast, err := parser.New(strings.NewReader(tt.code)).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		env := runtime.New(1024)
+		buf := &bytes.Buffer{}
+		env.Stdout = buf
+		env.Stack.PushString(name)
+		if err := parser.Eval(env, ast); err != nil {
+			t.Errorf("%d. unexpected error: %v", i, err)
+			continue
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("%d. expected output %q but received: %q", i, tt.expected, buf.String())
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	const code = `"notes" mkdir .
+"notes/a.txt" create drop "one\n" send 2drop close drop
+"notes/a.txt" open-append drop "two\n" send 2drop close drop
+"/notes/../../notes/a.txt" open drop read-all drop >str . close drop
+"notes/a.txt" "notes/b.txt" rename .
+"notes/a.txt" exists? . "notes/b.txt" exists? .
+"notes" list-dir drop .
+"notes/b.txt" stat drop "size" get . drop "notes" stat drop "dir" get . drop
+"notes/b.txt" "r+" open-mode drop "ONE" send 2drop close drop "notes/b.txt" open drop read-line drop . close drop
+"notes/b.txt" remove . "notes/b.txt" remove . .`
+	ast, err := parser.New(strings.NewReader(code)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := runtime.New(1024)
+	env.Root = t.TempDir()
+	buf := &bytes.Buffer{}
+	env.Stdout = buf
+	if err := parser.Eval(env, ast); err != nil {
+		t.Fatal(err)
+	}
+	expected := "0one\ntwo\n0falsetrue{ b.txt }8trueONE01remove notes/b.txt: no such file or directory"
+	if buf.String() != expected {
+		t.Errorf("expected output %q but received: %q", expected, buf.String())
+	}
+	if fi, err := os.Stat(filepath.Join(env.Root, "notes")); err != nil || !fi.IsDir() {
+		t.Errorf("expected notes directory under root, got %v", err)
+	}
+}
+
+func TestStdin(t *testing.T) {
+	for i, tt := range []struct {
+		code     string
+		stdin    string
+		expected string
+	}{
+		{`key drop . key drop . key drop byte>num . read-stdin-line drop . stdin-lines [ upper ] map . read-stdin-line . key . stdin "x" send . . drop`,
+			"ab\nline two\r\nthree\nfour", "ab10line two{ THREE FOUR }-1-11cannot write to stdin"},
+		{`key drop . stdin read-line drop . close . read-stdin-line drop . stdin-lines [ . ] each`, "x\ny\nz\n", "x0yz"},
+		{`stdin dup . .s close .`, "", "<pipe><1> <pipe>0"},
+		{`stdin-lines [ "#" starts-with? not ] filter len .`, "#a\nb\n#c\nd\n", "2"},
+	} {
+		ast, err := parser.New(strings.NewReader(tt.code)).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		env := runtime.New(1024)
+		buf := &bytes.Buffer{}
+		env.Stdout = buf
+		env.Stdin = strings.NewReader(tt.stdin)
+		if err := parser.Eval(env, ast); err != nil {
+			t.Errorf("%d. unexpected error: %v", i, err)
+			continue
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("%d. expected output %q but received: %q", i, tt.expected, buf.String())
+		}
+	}
+}
+
+func TestListen(t *testing.T) {
+	for i, tt := range []struct {
+		code     string
+		expected string
+	}{
+		{`"tcp" "127.0.0.1:0" listen drop
+listener-addr "127.0.0.1:" starts-with? .
+listener-addr "tcp" swap dial drop "ping\n" send 2drop
+swap accept drop read-line drop . "pong\n" send 2drop close drop
+close . read-line drop . close .`, "trueping0pong0"},
+		{`"tcp" "127.0.0.1:0" listen drop dup close drop accept . drop type .`, "1listener"},
+		{`"unix" "s.sock" listen drop "s.sock" exists? .
+"unix" "/s.sock" dial drop "hi" send 2drop close drop
+accept drop 2 read-n drop >str . close drop close . "s.sock" exists? .`, "truehi0false"},
+	} {
+		ast, err := parser.New(strings.NewReader(tt.code)).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		env := runtime.New(1024)
+		env.Root = t.TempDir()
+		buf := &bytes.Buffer{}
+		env.Stdout = buf
+		if err := parser.Eval(env, ast); err != nil {
+			t.Errorf("%d. unexpected error: %v", i, err)
+			continue
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("%d. expected output %q but received: %q", i, tt.expected, buf.String())
+		}
+	}
+}
+
+func TestStackLimit(t *testing.T) {
+	for i, tt := range []struct {
+		code   string
+		stack  int
+		ret    int
+		depth  int
+		output string
+	}{
+		{"100000 0 for I end depth .", 0, 0, -1, "100000"},
+		{"1 2 3 4", 4, 0, -1, ""},
+		{"1 2 3 4 5", 4, 0, 4, ""},
+		{"1 2 2dup", 3, 0, 2, ""},
+		{"1 0 for 1 0 for 1 0 for end end end", 0, 4, 4, ""},
+	} {
+		ast, err := parser.New(strings.NewReader(tt.code)).Parse()
+		if err != nil {
+			t.Errorf("%d. error parsing: %s\n%s", i, tt.code, err)
+			continue
+		}
+		env := runtime.New(tt.stack)
+		env.Return.Limit = tt.ret
+		buf := &bytes.Buffer{}
+		env.Stdout = buf
+		err = parser.Eval(env, ast)
+		var e *runtime.StackOverflowError
+		if tt.depth < 0 && err != nil || tt.depth >= 0 && (!errors.As(err, &e) || e.Depth != tt.depth) {
+			t.Errorf("%d. code %s\nexpected overflow at depth %d but received: %v", i, tt.code, tt.depth, err)
+		}
+		if buf.String() != tt.output {
+			t.Errorf("%d. code: %s\nshould produce output: %s\nbut received: %s", i, tt.code, tt.output, buf.String())
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	for i, tt := range []struct {
+		code      string
+		undefined []string
+	}{
+		{`1 dup + .`, nil},
+		{`: a b ; : b 1 . ; a`, nil},
+		{`var foo foo @ .`, nil},
+		{`1 dpu . : sq dup mul ;`, []string{"1:3: dpu", "1:18: mul"}},
+		{`1 1 = if foo else { bar } then 5 0 for baz end`, []string{"1:10: foo", "1:21: bar", "1:40: baz"}},
+	} {
+		ast, err := parser.New(strings.NewReader(tt.code)).Parse()
+		if err != nil {
+			t.Errorf("%d. error parsing: %s\n%s", i, tt.code, err)
+			continue
+		}
+		err = parser.Resolve(runtime.New(1024), ast)
+		if tt.undefined == nil {
+			if err != nil {
+				t.Errorf("%d. code %s\nshould resolve but received: %v", i, tt.code, err)
+			}
+			continue
+		}
+		errs, ok := err.(parser.ErrorList)
+		if !ok || len(errs) != len(tt.undefined) {
+			t.Errorf("%d. code %s\nexpecting %d undefined words got: %v", i, tt.code, len(tt.undefined), err)
+			continue
+		}
+		for j, e := range errs {
+			if got := e.Pos.String() + ": " + e.Word; got != tt.undefined[j] {
+				t.Errorf("%d. expecting %s got %s", i, tt.undefined[j], got)
+			}
+		}
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/bruston/roost/lexer"
 	"github.com/bruston/roost/runtime"
@@ -17,19 +20,81 @@ type Parser struct {
 	currentParent Appendable
 }
 
-func New(r io.Reader) *Parser {
-	p := &Parser{scn: lexer.NewScanner(r)}
+func New(r io.Reader) *Parser { return NewFile("", r) }
+
+// NewFile returns a Parser whose node positions and errors refer to filename.
+func NewFile(filename string, r io.Reader) *Parser {
+	p := &Parser{scn: lexer.NewFileScanner(filename, r, 0)}
 	return p
 }
 
+// Error is a parse or evaluation error tied to a location in the source and
+// the word, or keyword, found there. Trace holds the calls to script defined
+// words that were in progress, innermost first.
+type Error struct {
+	Pos   lexer.Pos
+	Word  string
+	Err   error
+	Trace []Frame
+}
+
+// Frame is a call to a word defined by the script.
+type Frame struct {
+	Word string
+	Pos  lexer.Pos
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.Word == "" {
+		fmt.Fprintf(&b, "%s: %v", e.Pos, e.Err)
+	} else {
+		fmt.Fprintf(&b, "%s: %s: %v", e.Pos, e.Word, e.Err)
+	}
+	// runs of the same frame, left by recursion, are printed once
+	for i, n := 0, 0; i < len(e.Trace); i += n {
+		f := e.Trace[i]
+		for n = 1; i+n < len(e.Trace) && e.Trace[i+n] == f; n++ {
+		}
+		fmt.Fprintf(&b, "\n\tin %s called at %s", f.Word, f.Pos)
+		if n > 1 {
+			fmt.Fprintf(&b, " (%d times)", n)
+		}
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func errorAt(tok lexer.Token, msg string) error {
+	return &Error{Pos: tok.Pos, Word: tok.Value, Err: errors.New(msg)}
+}
+
 type Node interface {
+	Pos() lexer.Pos
+	End() lexer.Pos
 }
 
-type NodeWord struct{ Identifier string }
+// Span is the region of source a node was parsed from.
+type Span struct {
+	Start, Stop lexer.Pos
+}
+
+func (s Span) Pos() lexer.Pos { return s.Start }
+
+func (s Span) End() lexer.Pos { return s.Stop }
+
+func spanOf(tok lexer.Token) Span { return Span{tok.Pos, tok.End} }
+
+type NodeWord struct {
+	Identifier string
+	Span
+}
 
 func (nw NodeWord) String() string { return nw.Identifier }
 
 type Appendable interface {
+	Node
 	Append(Node)
 	Parent() Appendable
 }
@@ -38,32 +103,111 @@ type NodeWordDef struct {
 	Identifier string
 	Body       []Node
 	parent     Appendable
+	Span
 }
 
 func (nw *NodeWordDef) Append(node Node) { nw.Body = append(nw.Body, node) }
 
 func (nw *NodeWordDef) Parent() Appendable { return nw.parent }
 
-type NodeVarDef struct{ Identifier string }
+type NodeVarDef struct {
+	Identifier string
+	Span
+}
 
-type NodeNumLit struct{ Value float64 }
+type NodeNumLit struct {
+	Value float64
+	Span
+}
 
 func (nl NodeNumLit) String() string { return fmt.Sprintf("%f", nl.Value) }
 
-type NodeStringLit struct{ Value string }
+type NodeBigIntLit struct {
+	Value *big.Int
+	Span
+}
+
+func (nl NodeBigIntLit) String() string { return nl.Value.String() + "n" }
+
+type NodeDecimalLit struct {
+	Value types.DecimalValue
+	Span
+}
+
+func (nl NodeDecimalLit) String() string { return nl.Value.String() + "d" }
+
+type NodeIntLit struct {
+	Value int64
+	Span
+}
+
+func (nl NodeIntLit) String() string { return strconv.FormatInt(nl.Value, 10) }
+
+type NodeByteLit struct {
+	Value byte
+	Span
+}
+
+func (nb NodeByteLit) String() string {
+	if nb.Value == '\'' || nb.Value == '\\' {
+		return fmt.Sprintf("'\\%c'", nb.Value)
+	}
+	if nb.Value < 0x80 && strconv.IsPrint(rune(nb.Value)) {
+		return fmt.Sprintf("'%c'", nb.Value)
+	}
+	return fmt.Sprintf("'\\x%02x'", nb.Value)
+}
+
+type NodeStringLit struct {
+	Value string
+	Span
+}
 
 func (ns NodeStringLit) String() string { return ns.Value }
 
+// quote returns s as a string literal which reads back as s, using only the
+// escapes the lexer accepts.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&b, "\\x%02x", s[i])
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString("\\n")
+		case r == '\r':
+			b.WriteString("\\r")
+		case r == '\t':
+			b.WriteString("\\t")
+		case strconv.IsPrint(r):
+			b.WriteString(s[i : i+size])
+		case r < 0x80:
+			fmt.Fprintf(&b, "\\x%02x", r)
+		default:
+			fmt.Fprintf(&b, "\\u{%x}", r)
+		}
+		i += size
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
 type CollectionType int
 
 const (
-	ListCollection CollectionType = iota
-	SliceCollection
+	SliceCollection CollectionType = iota
+	MapCollection
 )
 
 type BlobNode struct {
 	parent Appendable
 	body   []Node
+	Span
 }
 
 func (b *BlobNode) Append(node Node) {
@@ -76,6 +220,7 @@ type NodeCollection struct {
 	Type   CollectionType
 	Body   []Node
 	parent Appendable
+	Span
 }
 
 func (nc *NodeCollection) Append(node Node) { nc.Body = append(nc.Body, node) }
@@ -86,11 +231,14 @@ type NodeIf struct {
 	Body   []Node
 	Else   *NodeElse
 	parent Appendable
+	Span
 }
 
 type NodeElse struct {
 	Body   []Node
 	parent Appendable
+	owner  *NodeIf
+	Span
 }
 
 func (ne *NodeElse) Append(node Node) { ne.Body = append(ne.Body, node) }
@@ -101,11 +249,14 @@ func (ne *NodeIf) Append(node Node) { ne.Body = append(ne.Body, node) }
 
 func (ne *NodeIf) Parent() Appendable { return ne.parent }
 
-type NodeRef string
+type NodeRef struct {
+	Identifier string
+	Span
+}
 
-func (nr NodeRef) String() string { return string(nr) }
+func (nr NodeRef) String() string { return nr.Identifier }
 
-func (nr NodeRef) Value() interface{} { return string(nr) }
+func (nr NodeRef) Value() interface{} { return nr.Identifier }
 
 func (p *Parser) insertNode(node Node) {
 	if p.currentParent != nil {
@@ -115,101 +266,384 @@ func (p *Parser) insertNode(node Node) {
 	p.tree = append(p.tree, node)
 }
 
+// NodeFor is a counted loop. A for loop counts up by one, a step loop takes
+// its increment from the stack.
 type NodeFor struct {
 	Body   []Node
+	Step   bool
 	parent Appendable
+	Span
 }
 
 func (nf *NodeFor) Append(node Node) { nf.Body = append(nf.Body, node) }
 
 func (nf *NodeFor) Parent() Appendable { return nf.parent }
 
+// NodeBegin is a loop that runs until a condition is met. It is a
+// begin ... until loop when While is nil and begin ... while ... repeat
+// otherwise.
+type NodeBegin struct {
+	Body   []Node
+	While  *NodeWhile
+	parent Appendable
+	Span
+}
+
+func (nb *NodeBegin) Append(node Node) { nb.Body = append(nb.Body, node) }
+
+func (nb *NodeBegin) Parent() Appendable { return nb.parent }
+
+type NodeWhile struct {
+	Body   []Node
+	parent Appendable
+	owner  *NodeBegin
+	Span
+}
+
+func (nw *NodeWhile) Append(node Node) { nw.Body = append(nw.Body, node) }
+
+func (nw *NodeWhile) Parent() Appendable { return nw.parent }
+
+// NodeLeave exits the innermost loop.
+type NodeLeave struct {
+	Span
+}
+
+// NodeExit returns from the current word definition, or ends the program
+// outside of one.
+type NodeExit struct {
+	Span
+}
+
+// NodeRecurse calls the word definition it appears in.
+type NodeRecurse struct {
+	def *NodeWordDef
+	Span
+}
+
+// definition returns the word definition the current parent is, or is nested
+// in, or nil.
+func (p *Parser) definition() *NodeWordDef {
+	for n := p.currentParent; n != nil; n = n.Parent() {
+		if def, ok := n.(*NodeWordDef); ok {
+			return def
+		}
+	}
+	return nil
+}
+
+// inLoop reports whether the current parent is a loop, or nested in one
+// within the same definition.
+func (p *Parser) inLoop() bool {
+	for n := p.currentParent; n != nil; n = n.Parent() {
+		switch n.(type) {
+		case *NodeFor, *NodeBegin, *NodeWhile:
+			return true
+		case *NodeWordDef, *NodeCollection, *NodeQuotation:
+			return false
+		}
+	}
+	return false
+}
+
+// parseNumber parses a number literal. Literals with a fraction or exponent
+// are floats, others, including those with a 0x, 0o or 0b base prefix, are
+// integers. An n suffix makes a big integer and a d suffix, on literals
+// without a base prefix, a decimal. Underscores may separate digits.
+func parseNumber(tok lexer.Token) (Node, error) {
+	lit := tok.Value
+	s := strings.TrimPrefix(lit, "-")
+	prefixed := len(s) > 1 && s[0] == '0' && strings.ContainsRune("xXoObB", rune(s[1]))
+	var (
+		node Node
+		err  error
+	)
+	switch {
+	case strings.HasSuffix(lit, "n"):
+		lit, base := lit[:len(lit)-1], 0
+		if !prefixed {
+			// SetString would read a leading 0 as octal and only accepts
+			// underscores alongside a base prefix
+			if strings.ContainsAny(lit, ".eE") || !validDigits(lit) {
+				return nil, errors.New("malformed number")
+			}
+			lit, base = strings.ReplaceAll(lit, "_", ""), 10
+		}
+		n, ok := new(big.Int).SetString(lit, base)
+		if !ok {
+			err = strconv.ErrSyntax
+		}
+		node = NodeBigIntLit{Value: n, Span: spanOf(tok)}
+	case strings.HasSuffix(lit, "d") && !prefixed:
+		lit = lit[:len(lit)-1]
+		if !validDigits(lit) {
+			return nil, errors.New("malformed number")
+		}
+		var d types.DecimalValue
+		d, err = types.ParseDecimal(lit)
+		node = NodeDecimalLit{Value: d, Span: spanOf(tok)}
+	case prefixed:
+		var i int64
+		i, err = strconv.ParseInt(lit, 0, 64)
+		node = NodeIntLit{Value: i, Span: spanOf(tok)}
+	case strings.ContainsAny(lit, ".eE"):
+		var f float64
+		f, err = strconv.ParseFloat(lit, 64)
+		node = NodeNumLit{Value: f, Span: spanOf(tok)}
+	default:
+		// ParseFloat validates the placement of underscores, ParseInt
+		// only accepts them alongside a base prefix
+		if _, err = strconv.ParseFloat(lit, 64); err == nil {
+			var i int64
+			i, err = strconv.ParseInt(strings.ReplaceAll(lit, "_", ""), 10, 64)
+			node = NodeIntLit{Value: i, Span: spanOf(tok)}
+		}
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		return nil, errors.New("number out of range")
+	}
+	if err != nil {
+		return nil, errors.New("malformed number")
+	}
+	return node, nil
+}
+
+// validDigits reports whether lit is a well formed decimal literal, whatever
+// its magnitude.
+func validDigits(lit string) bool {
+	_, err := strconv.ParseFloat(lit, 64)
+	return err == nil || errors.Is(err, strconv.ErrRange)
+}
+
+// closeParent records tok as the end of the current parent and makes its
+// parent current.
+func (p *Parser) closeParent(tok lexer.Token) {
+	if n, ok := p.currentParent.(interface{ setEnd(lexer.Pos) }); ok {
+		n.setEnd(tok.End)
+	}
+	p.currentParent = p.currentParent.Parent()
+}
+
+func (s *Span) setEnd(pos lexer.Pos) { s.Stop = pos }
+
+// closer returns the word that closes n.
+func closer(n Appendable) string {
+	switch n.(type) {
+	case *NodeWordDef:
+		return ";"
+	case *NodeIf, *NodeElse:
+		return "then"
+	case *NodeFor:
+		return "end"
+	case *NodeBegin:
+		return "until or repeat"
+	case *NodeWhile:
+		return "repeat"
+	case *NodeQuotation:
+		return "]"
+	case *NodeCollection:
+		return "}"
+	}
+	return ""
+}
+
+// mismatch returns the error for a closing word which doesn't close the
+// current parent, naming the word that does.
+func (p *Parser) mismatch(tok lexer.Token) error {
+	if p.currentParent == nil {
+		return errorAt(tok, "unexpected "+tok.Value)
+	}
+	return errorAt(tok, "unexpected "+tok.Value+", expecting "+closer(p.currentParent))
+}
+
+// Parse parses the whole input. A lexer error found before a parse error is
+// reported instead of it, since it is likely the cause.
 func (p *Parser) Parse() ([]Node, error) {
+	tree, err := p.parse()
+	if err == nil {
+		return tree, nil
+	}
+	if serr := p.scanErr(); serr != nil {
+		se, ok := serr.(*Error)
+		pe, ok2 := err.(*Error)
+		if !ok || !ok2 || se.Pos.Offset <= pe.Pos.Offset {
+			return nil, serr
+		}
+	}
+	return nil, err
+}
+
+// scanErr returns the error the scanner has recorded, if any.
+func (p *Parser) scanErr() error {
+	err := p.scn.Err()
+	if e, ok := err.(*lexer.Error); ok {
+		return &Error{Pos: e.Pos, Err: errors.New(e.Msg)}
+	}
+	return err
+}
+
+func (p *Parser) parse() ([]Node, error) {
 	for p.scn.Scan() {
 		token := p.scn.Token()
 		switch token.Type {
 		case lexer.EOF:
 			break
 		case lexer.String:
-			p.insertNode(NodeStringLit{Value: token.Value})
+			p.insertNode(NodeStringLit{Value: token.Value, Span: spanOf(token)})
+		case lexer.Byte:
+			if token.Value == "" {
+				// the scanner has recorded an error, reported after the loop
+				continue
+			}
+			p.insertNode(NodeByteLit{Value: token.Value[0], Span: spanOf(token)})
 		case lexer.Number:
-			n, _ := strconv.ParseFloat(token.Value, 64)
-			p.insertNode(NodeNumLit{Value: n})
+			node, err := parseNumber(token)
+			if err != nil {
+				return nil, &Error{Pos: token.Pos, Word: token.Value, Err: err}
+			}
+			p.insertNode(node)
 		case lexer.Word:
 			if token.Value[0] == '&' && len(token.Value) > 1 {
-				p.insertNode(NodeRef(token.Value[1:]))
+				p.insertNode(NodeRef{Identifier: token.Value[1:], Span: spanOf(token)})
 				continue
 			}
-			p.insertNode(NodeWord{Identifier: token.Value})
+			p.insertNode(NodeWord{Identifier: token.Value, Span: spanOf(token)})
 		case lexer.Colon:
 			name := p.scn.Token()
 			if name.Type != lexer.Word {
-				return nil, fmt.Errorf("expecting word after semicolon, got: %v", name)
+				return nil, errorAt(name, "expecting word after colon")
 			}
-			node := &NodeWordDef{Identifier: name.Value}
+			node := &NodeWordDef{Identifier: name.Value, Span: spanOf(token)}
 			node.parent = p.currentParent
 			p.insertNode(node)
 			p.currentParent = node
 		case lexer.Semicolon:
 			if p.currentParent == nil {
-				return nil, errors.New("unexpected semicolon outside of word definition")
+				return nil, errorAt(token, "unexpected semicolon outside of word definition")
+			}
+			if _, ok := p.currentParent.(*NodeWordDef); !ok {
+				return nil, p.mismatch(token)
 			}
-			p.tree = append(p.tree, p.currentParent)
-			p.currentParent = p.currentParent.Parent()
+			if p.currentParent.Parent() != nil {
+				// definitions nested in other nodes are also made at the top level
+				p.tree = append(p.tree, p.currentParent)
+			}
+			p.closeParent(token)
 		case lexer.Var:
 			name := p.scn.Token()
 			if name.Type != lexer.Word {
-				return nil, fmt.Errorf("expecting word after var, got: %v", name)
+				return nil, errorAt(name, "expecting word after var")
 			}
-			node := NodeVarDef{Identifier: name.Value}
+			node := NodeVarDef{Identifier: name.Value, Span: Span{token.Pos, name.End}}
 			p.insertNode(node)
 		case lexer.If:
-			node := &NodeIf{
-				parent: p.currentParent,
-				Else:   &NodeElse{parent: p.currentParent},
-			}
+			node := &NodeIf{parent: p.currentParent, Span: spanOf(token)}
+			node.Else = &NodeElse{parent: p.currentParent, owner: node}
 			p.insertNode(node)
 			p.currentParent = node
 		case lexer.Else:
 			node, ok := p.currentParent.(*NodeIf)
 			if !ok {
-				return nil, errors.New("expecting else to be inside if")
+				return nil, errorAt(token, "expecting else to be inside if")
 			}
+			node.Else.Span = spanOf(token)
 			p.currentParent = node.Else
 		case lexer.Then:
-			if p.currentParent == nil {
-				return nil, fmt.Errorf("unexpected then")
+			switch n := p.currentParent.(type) {
+			case *NodeIf:
+			case *NodeElse:
+				// then closes the if an else belongs to as well
+				n.owner.setEnd(token.End)
+			default:
+				return nil, p.mismatch(token)
 			}
-			p.currentParent = p.currentParent.Parent()
-		case lexer.For:
-			node := &NodeFor{parent: p.currentParent}
+			p.closeParent(token)
+		case lexer.For, lexer.Step:
+			node := &NodeFor{Step: token.Type == lexer.Step, parent: p.currentParent, Span: spanOf(token)}
 			p.insertNode(node)
 			p.currentParent = node
 		case lexer.End:
-			if p.currentParent == nil {
-				return nil, errors.New("unexpected end")
+			if _, ok := p.currentParent.(*NodeFor); !ok {
+				return nil, p.mismatch(token)
 			}
-			p.currentParent = p.currentParent.Parent()
-		case lexer.BracketOpen:
-			node := &NodeCollection{
-				Type:   ListCollection,
-				parent: p.currentParent,
+			p.closeParent(token)
+		case lexer.Begin:
+			node := &NodeBegin{parent: p.currentParent, Span: spanOf(token)}
+			p.insertNode(node)
+			p.currentParent = node
+		case lexer.Until:
+			if _, ok := p.currentParent.(*NodeBegin); !ok {
+				return nil, errorAt(token, "expecting until to close begin")
+			}
+			p.closeParent(token)
+		case lexer.While:
+			node, ok := p.currentParent.(*NodeBegin)
+			if !ok {
+				return nil, errorAt(token, "expecting while to be inside begin")
 			}
+			node.While = &NodeWhile{parent: node.parent, owner: node, Span: spanOf(token)}
+			p.currentParent = node.While
+		case lexer.Repeat:
+			n, ok := p.currentParent.(*NodeWhile)
+			if !ok {
+				return nil, errorAt(token, "expecting repeat to close begin ... while")
+			}
+			// repeat closes the begin a while belongs to as well
+			n.owner.setEnd(token.End)
+			p.closeParent(token)
+		case lexer.Leave:
+			if !p.inLoop() {
+				return nil, errorAt(token, "leave outside of loop")
+			}
+			p.insertNode(NodeLeave{Span: spanOf(token)})
+		case lexer.Exit:
+			p.insertNode(NodeExit{Span: spanOf(token)})
+		case lexer.Recurse:
+			def := p.definition()
+			if def == nil {
+				return nil, errorAt(token, "recurse outside of word definition")
+			}
+			p.insertNode(NodeRecurse{def: def, Span: spanOf(token)})
+		case lexer.BracketOpen:
+			node := &NodeQuotation{parent: p.currentParent, Span: spanOf(token)}
 			p.insertNode(node)
 			p.currentParent = node
-		case lexer.BraceOpen:
+		case lexer.BraceOpen, lexer.MapOpen:
 			node := &NodeCollection{
 				Type:   SliceCollection,
 				parent: p.currentParent,
+				Span:   spanOf(token),
+			}
+			if token.Type == lexer.MapOpen {
+				node.Type = MapCollection
 			}
 			p.insertNode(node)
 			p.currentParent = node
-		case lexer.BracketClose, lexer.BraceClose:
-			p.currentParent = p.currentParent.Parent()
-		case lexer.ParenOpen:
+		case lexer.BracketClose:
+			if _, ok := p.currentParent.(*NodeQuotation); !ok {
+				return nil, errorAt(token, "unexpected ]")
+			}
+			p.closeParent(token)
+		case lexer.BraceClose:
+			n, ok := p.currentParent.(*NodeCollection)
+			if !ok {
+				return nil, errorAt(token, "unexpected }")
+			}
+			if n.Type == MapCollection && len(n.Body)%2 != 0 {
+				return nil, errorAt(token, "map literal has a key without a value")
+			}
+			p.closeParent(token)
 		case lexer.ParenClose:
+			return nil, errorAt(token, "unexpected ) outside of comment")
+		case lexer.Comment:
 		}
 	}
+	if err := p.scanErr(); err != nil {
+		return nil, err
+	}
+	if n := p.currentParent; n != nil {
+		return nil, &Error{Pos: n.Pos(), Word: describe(n), Err: errors.New("unterminated at end of input")}
+	}
 	return p.tree, nil
 }
 
@@ -223,105 +657,337 @@ func Walk(v Visitor, node Node) {
 	}
 }
 
-func funcFromDef(ev *Evaluator, n *NodeWordDef) runtime.FuncValue {
-	return runtime.FuncValue(func(e *runtime.Env) {
-		for _, c := range n.Body {
-			Walk(ev, c)
+// funcFromDef returns a word which evaluates the body of n against whichever
+// Env it is called with. A call the body makes in tail position is returned
+// as a *runtime.TailCall.
+func funcFromDef(n *NodeWordDef) runtime.FuncValue {
+	return runtime.FuncValue(func(e *runtime.Env) error { return run(e, n.Body) })
+}
+
+// run evaluates the body of a word or quotation.
+func run(e *runtime.Env, body []Node) error {
+	if e.MaxCallDepth > 0 && e.CallDepth >= e.MaxCallDepth {
+		return &runtime.StackOverflowError{Depth: e.CallDepth}
+	}
+	e.CallDepth++
+	defer func() { e.CallDepth-- }()
+	ev := &Evaluator{env: e}
+	depth := e.Return.Len()
+	ev.walk(body, true)
+	if ev.err != nil {
+		return ev.err
+	}
+	if e.Return.Len() != depth {
+		return &runtime.ReturnStackError{Delta: e.Return.Len() - depth}
+	}
+	if ev.next != nil {
+		return ev.next
+	}
+	return nil
+}
+
+// tailCall returns a tail call to word which reports errors as occurring at
+// node.
+func tailCall(node Node, word runtime.FuncValue) *runtime.TailCall {
+	return &runtime.TailCall{Word: func(e *runtime.Env) error {
+		err := word(e)
+		if _, ok := err.(*runtime.TailCall); ok || err == nil {
+			return err
 		}
-	})
+		return errorAtNode(node, err)
+	}}
+}
+
+// walk evaluates body, if tail is set its last node is in tail position.
+func (ev *Evaluator) walk(body []Node, tail bool) {
+	for i, c := range body {
+		ev.tail = tail && i == len(body)-1
+		Walk(ev, c)
+	}
+}
+
+// describe returns the source text a node is best identified by in errors.
+func describe(node Node) string {
+	switch n := node.(type) {
+	case NodeWord:
+		return n.Identifier
+	case NodeRef:
+		return "&" + n.Identifier
+	case NodeStringLit:
+		return quote(n.Value)
+	case NodeNumLit:
+		lit := strconv.FormatFloat(n.Value, 'g', -1, 64)
+		if !strings.ContainsAny(lit, ".eIN") {
+			// keep it a float if read back
+			lit += ".0"
+		}
+		return lit
+	case NodeIntLit:
+		return n.String()
+	case NodeBigIntLit:
+		return n.String()
+	case NodeDecimalLit:
+		return n.String()
+	case NodeByteLit:
+		return n.String()
+	case *NodeWordDef:
+		return ":"
+	case NodeVarDef:
+		return "var"
+	case *NodeIf:
+		return "if"
+	case *NodeElse:
+		return "else"
+	case *NodeFor:
+		if n.Step {
+			return "step"
+		}
+		return "for"
+	case *NodeBegin:
+		return "begin"
+	case *NodeWhile:
+		return "while"
+	case NodeLeave:
+		return "leave"
+	case NodeExit:
+		return "exit"
+	case NodeRecurse:
+		return "recurse"
+	case *NodeCollection:
+		if n.Type == MapCollection {
+			return "#{"
+		}
+		return "{"
+	case *NodeQuotation:
+		return "["
+	}
+	return ""
 }
 
 func (ev *Evaluator) Visit(node Node) Visitor {
+	tail := ev.tail
+	ev.tail = false
+	if ev.err != nil || ev.leave || ev.exit {
+		return nil
+	}
 	defer func() {
 		if r := recover(); r != nil {
-			ev.err = runtime.ErrStackError
+			err, ok := r.(error)
+			if !ok {
+				err = fmt.Errorf("%v", r)
+			}
+			ev.fail(node, err)
 		}
 	}()
 	switch n := node.(type) {
 	case *NodeWordDef:
-		ev.env.Words[n.Identifier] = funcFromDef(ev, n)
+		ev.env.Words[n.Identifier] = funcFromDef(n)
 	case NodeWord:
 		if word, ok := ev.env.Words[n.Identifier]; ok {
-			word(ev.env)
+			if tail {
+				ev.next = tailCall(n, word)
+				return ev
+			}
+			if err := ev.env.Call(word); err != nil {
+				ev.fail(n, err)
+			}
 			return ev
 		}
-		if word, ok := ev.env.Builtin[n.Identifier]; ok {
-			word(ev.env)
+		word, ok := ev.env.Builtin[n.Identifier]
+		if !ok {
+			ev.fail(n, &runtime.UndefinedWordError{Word: n.Identifier})
+			return ev
+		}
+		if err := word(ev.env); err != nil {
+			ev.fail(n, err)
 		}
 	case NodeStringLit:
 		ev.env.Stack.PushString(n.Value)
 	case NodeNumLit:
 		ev.env.Stack.PushNum(n.Value)
+	case NodeIntLit:
+		ev.env.Stack.PushInt(n.Value)
+	case NodeBigIntLit:
+		ev.env.Stack.Push(types.NewBigInt(n.Value))
+	case NodeDecimalLit:
+		ev.env.Stack.Push(n.Value)
+	case NodeByteLit:
+		ev.env.Stack.PushByte(n.Value)
 	case NodeVarDef:
-		ref := NodeRef(n.Identifier)
-		ev.env.Words[n.Identifier] = funcFromDef(ev, &NodeWordDef{
+		ref := NodeRef{Identifier: n.Identifier, Span: n.Span}
+		ev.env.Words[n.Identifier] = funcFromDef(&NodeWordDef{
 			Identifier: n.Identifier,
 			Body:       []Node{ref},
+			Span:       n.Span,
 		})
 		ev.env.Stack.Push(types.NewRef(n.Identifier))
 	case NodeRef:
-		ev.env.Stack.Push(types.NewRef(string(n)))
+		ev.env.Stack.Push(types.NewRef(n.Identifier))
 	case *NodeIf:
-		cond := ev.env.Stack.Pop()
-		if cond.Value() == true || cond.Value() == 1 {
-			for _, c := range n.Body {
-				Walk(ev, c)
-			}
+		v := ev.env.Stack.Pop()
+		cond, ok := v.(types.BoolValue)
+		if !ok {
+			ev.fail(n, &runtime.TypeError{Expected: []types.ValueType{types.ValueBool}, Actual: types.TypeOf(v)})
+			return nil
+		}
+		if cond.Val {
+			ev.walk(n.Body, tail)
+			return ev
+		}
+		ev.walk(n.Else.Body, tail)
+	case *NodeFor:
+		ev.evalFor(n)
+	case *NodeBegin:
+		ev.evalBegin(n)
+	case NodeLeave:
+		ev.leave = true
+	case NodeExit:
+		ev.exit = true
+	case NodeRecurse:
+		if tail {
+			ev.next = tailCall(n, funcFromDef(n.def))
 			return ev
 		}
-		for _, c := range n.Else.Body {
+		if err := ev.env.Call(funcFromDef(n.def)); err != nil {
+			ev.fail(n, err)
+		}
+	case *NodeCollection, *NodeQuotation:
+		if v := ev.evalNode(n); ev.err == nil {
+			ev.env.Stack.Push(v)
+		}
+	}
+	return ev
+}
+
+// evalFor runs a counted loop. The limit and index are kept on the return
+// stack, the index on top, where I, J and K can read them. The loop runs
+// while the index is below the limit, or above it when counting down.
+func (ev *Evaluator) evalFor(n *NodeFor) {
+	e := ev.env
+	var step types.Number = types.NewInt(1)
+	if n.Step {
+		v := e.Stack.Pop()
+		s, ok := v.(types.Number)
+		if !ok {
+			ev.fail(n, numberExpected(v))
+			return
+		}
+		if s.Float() == 0 {
+			ev.fail(n, runtime.ErrZeroStep)
+			return
+		}
+		step = s
+	}
+	var bounds [2]types.Number
+	for i := range bounds {
+		v := e.Stack.Pop()
+		b, ok := v.(types.Number)
+		if !ok {
+			ev.fail(n, numberExpected(v))
+			return
+		}
+		bounds[i] = b
+	}
+	index, limit := bounds[0], bounds[1]
+	e.Return.Push(limit)
+	e.Return.Push(index)
+	depth := e.Return.Len()
+	up := step.Float() > 0
+	for up && index.Float() < limit.Float() || !up && index.Float() > limit.Float() {
+		for _, c := range n.Body {
 			Walk(ev, c)
 		}
-	case *NodeFor:
-		ev.env.Stack.Swap()
-		ev.env.Return.Push(ev.env.Stack.Pop())
-		ev.env.Return.Push(ev.env.Stack.Pop())
-		for {
-			index := ev.env.Return.Pop()
-			limit := ev.env.Return.Peek()
-			if index.Type() != types.ValueNum || limit.Type() != types.ValueNum {
-				return ev
-			}
-			if index.Value().(float64) < limit.Value().(float64) || limit.Value().(float64) == 0 {
-				ev.env.Return.Push(index)
-				for _, c := range n.Body {
-					Walk(ev, c)
-				}
-				ev.env.Return.Drop()
-				ev.env.Return.PushNum(index.Value().(float64) + 1)
-				continue
-			}
+		if ev.err != nil {
+			return
+		}
+		if e.Return.Len() != depth {
+			ev.fail(n, &runtime.ReturnStackError{Delta: e.Return.Len() - depth})
+			return
+		}
+		if ev.leave || ev.exit {
+			ev.leave = false
 			break
 		}
-	case *NodeCollection:
-		collection := newCollection(n.Type)
-		for _, node := range n.Body {
-			collection.Insert(ev.evalNode(node))
+		i, iok := index.(types.IntValue)
+		s, sok := step.(types.IntValue)
+		if iok && sok {
+			index = types.NewInt(i.Val + s.Val)
+		} else {
+			index = types.NewNum(index.Float() + step.Float())
 		}
-		ev.env.Stack.Push(collection)
+		e.Return.Pop()
+		e.Return.Push(index)
 	}
-	return ev
+	e.Return.TwoDrop()
 }
 
-func newCollection(n CollectionType) types.Collection {
-	if n == SliceCollection {
-		return &types.SliceValue{ValueType: types.ValueSlice}
+// evalBegin runs a begin ... until or begin ... while ... repeat loop.
+func (ev *Evaluator) evalBegin(n *NodeBegin) {
+	for {
+		for _, c := range n.Body {
+			Walk(ev, c)
+		}
+		if ev.err != nil || ev.leave || ev.exit {
+			break
+		}
+		v := ev.env.Stack.Pop()
+		cond, ok := v.(types.BoolValue)
+		if !ok {
+			ev.fail(n, &runtime.TypeError{Expected: []types.ValueType{types.ValueBool}, Actual: types.TypeOf(v)})
+			return
+		}
+		if n.While == nil {
+			if cond.Val {
+				break
+			}
+			continue
+		}
+		if !cond.Val {
+			break
+		}
+		for _, c := range n.While.Body {
+			Walk(ev, c)
+		}
+		if ev.err != nil || ev.leave || ev.exit {
+			break
+		}
 	}
-	return nil
+	ev.leave = false
+}
+
+func numberExpected(v types.Value) error {
+	return &runtime.TypeError{Expected: []types.ValueType{types.ValueInt, types.ValueNum}, Actual: types.TypeOf(v)}
 }
 
 func (ev *Evaluator) evalNode(node Node) types.Value {
 	switch n := node.(type) {
 	case NodeNumLit:
 		return types.NewNum(n.Value)
+	case NodeIntLit:
+		return types.NewInt(n.Value)
+	case NodeBigIntLit:
+		return types.NewBigInt(n.Value)
+	case NodeDecimalLit:
+		return n.Value
 	case NodeStringLit:
 		return types.NewString(n.Value)
+	case NodeByteLit:
+		return types.NewByte(n.Value)
 	case *NodeCollection:
-		collection := newCollection(n.Type)
+		if n.Type == MapCollection {
+			return ev.evalMap(n)
+		}
+		collection := &types.SliceValue{ValueType: types.ValueSlice}
 		for _, c := range n.Body {
-			collection.Insert(ev.evalNode(c))
+			v := ev.literal(c, "slice element")
+			if ev.err != nil {
+				return nil
+			}
+			collection.Insert(v)
 		}
 		return collection
+	case *NodeQuotation:
+		return types.NewQuotation(quotation{n})
 	case NodeWord:
 		if n.Identifier == "true" {
 			return types.NewBool(true)
@@ -335,6 +1001,38 @@ func (ev *Evaluator) evalNode(node Node) types.Value {
 	return nil
 }
 
+// evalMap returns the map a map literal describes, its body alternates keys
+// and values.
+func (ev *Evaluator) evalMap(n *NodeCollection) types.Value {
+	m := types.NewMap()
+	for i := 0; i+1 < len(n.Body); i += 2 {
+		k := ev.literal(n.Body[i], "map key")
+		if ev.err != nil {
+			return nil
+		}
+		if !types.ValidKey(k) {
+			ev.fail(n.Body[i], &runtime.TypeError{Expected: types.KeyTypes, Actual: k.Type()})
+			return nil
+		}
+		v := ev.literal(n.Body[i+1], "map value")
+		if ev.err != nil {
+			return nil
+		}
+		m.Put(k, v)
+	}
+	return m
+}
+
+// literal evaluates part of a collection literal, failing if it isn't a
+// literal itself. what names the part in the error.
+func (ev *Evaluator) literal(node Node, what string) types.Value {
+	v := ev.evalNode(node)
+	if v == nil && ev.err == nil {
+		ev.fail(node, errors.New(what+" must be a literal"))
+	}
+	return v
+}
+
 func Eval(env *runtime.Env, ast []Node) error {
 	eval := &Evaluator{
 		env: env,
@@ -351,4 +1049,24 @@ func Eval(env *runtime.Env, ast []Node) error {
 type Evaluator struct {
 	env *runtime.Env
 	err error
+	// leave is set by leave and cleared by the loop it exits
+	leave bool
+	exit  bool
+	// tail is set while walking a node in tail position, next is the call
+	// such a node made, see tailCall
+	tail bool
+	next *runtime.TailCall
+}
+
+// fail records err as having occurred at node. An *Error returned from a
+// word defined in the script already carries the position it occurred at,
+// node is added to its trace instead.
+func (ev *Evaluator) fail(node Node, err error) { ev.err = errorAtNode(node, err) }
+
+func errorAtNode(node Node, err error) *Error {
+	if e, ok := err.(*Error); ok {
+		e.Trace = append(e.Trace, Frame{Word: describe(node), Pos: node.Pos()})
+		return e
+	}
+	return &Error{Pos: node.Pos(), Word: describe(node), Err: err}
 }
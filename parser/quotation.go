@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/bruston/roost/runtime"
+)
+
+// NodeQuotation is a block of code, [ ... ], which is pushed on the stack as
+// a quotation value instead of being run.
+type NodeQuotation struct {
+	Body   []Node
+	parent Appendable
+	Span
+}
+
+func (nq *NodeQuotation) Append(node Node) { nq.Body = append(nq.Body, node) }
+
+func (nq *NodeQuotation) Parent() Appendable { return nq.parent }
+
+// quotation is the runtime.Code of a quotation value. Calling a quotation
+// is like calling a word whose body is the quotation's, exit returns from
+// the quotation.
+type quotation struct{ node *NodeQuotation }
+
+func (q quotation) Run(e *runtime.Env) error { return run(e, q.node.Body) }
+
+func (q quotation) String() string { return format(q.node) }
+
+// format returns source code for node. Words and literals are as they were
+// written, but comments and the original spacing are lost.
+func format(node Node) string {
+	var b strings.Builder
+	formatNode(&b, node)
+	return b.String()
+}
+
+func formatNode(b *strings.Builder, node Node) {
+	body := func(nodes []Node) {
+		for _, n := range nodes {
+			b.WriteByte(' ')
+			formatNode(b, n)
+		}
+	}
+	switch n := node.(type) {
+	case *NodeWordDef:
+		b.WriteString(": " + n.Identifier)
+		body(n.Body)
+		b.WriteString(" ;")
+	case NodeVarDef:
+		b.WriteString("var " + n.Identifier)
+	case *NodeIf:
+		b.WriteString("if")
+		body(n.Body)
+		if len(n.Else.Body) > 0 {
+			b.WriteString(" else")
+			body(n.Else.Body)
+		}
+		b.WriteString(" then")
+	case *NodeFor:
+		b.WriteString(describe(n))
+		body(n.Body)
+		b.WriteString(" end")
+	case *NodeBegin:
+		b.WriteString("begin")
+		body(n.Body)
+		if n.While == nil {
+			b.WriteString(" until")
+			return
+		}
+		b.WriteString(" while")
+		body(n.While.Body)
+		b.WriteString(" repeat")
+	case *NodeCollection:
+		b.WriteString(describe(n))
+		body(n.Body)
+		b.WriteString(" }")
+	case *NodeQuotation:
+		b.WriteString("[")
+		body(n.Body)
+		b.WriteString(" ]")
+	default:
+		b.WriteString(describe(n))
+	}
+}
@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bruston/roost/lexer"
+	"github.com/bruston/roost/runtime"
+)
+
+// ErrorList is a list of errors found in a single pass over a program.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// String returns every error in the list, one per line.
+func (l ErrorList) String() string {
+	lines := make([]string, len(l))
+	for i, err := range l {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Resolve checks that every word used in ast is either a builtin, already
+// defined in env or defined somewhere in ast, without evaluating anything.
+// Words are looked up when they are called, so a definition may use a word
+// defined after it. The returned error, if any, is an ErrorList.
+func Resolve(env *runtime.Env, ast []Node) error {
+	defined := make(map[string]bool)
+	for _, node := range ast {
+		inspect(node, func(n Node) {
+			switch n := n.(type) {
+			case *NodeWordDef:
+				defined[n.Identifier] = true
+			case NodeVarDef:
+				defined[n.Identifier] = true
+			}
+		})
+	}
+	var errs ErrorList
+	// nested definitions appear in the tree twice, see Parse
+	reported := make(map[lexer.Pos]bool)
+	for _, node := range ast {
+		inspect(node, func(n Node) {
+			w, ok := n.(NodeWord)
+			if !ok || defined[w.Identifier] || reported[w.Pos()] {
+				return
+			}
+			if _, ok := env.Words[w.Identifier]; ok {
+				return
+			}
+			if _, ok := env.Builtin[w.Identifier]; ok {
+				return
+			}
+			reported[w.Pos()] = true
+			errs = append(errs, &Error{
+				Pos:  w.Pos(),
+				Word: w.Identifier,
+				Err:  &runtime.UndefinedWordError{Word: w.Identifier},
+			})
+		})
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// inspect calls f for node and every node nested within it, depth first.
+func inspect(node Node, f func(Node)) {
+	f(node)
+	var body []Node
+	switch n := node.(type) {
+	case *NodeWordDef:
+		body = n.Body
+	case *NodeIf:
+		body = n.Body
+		if n.Else != nil {
+			body = append(body[:len(body):len(body)], n.Else.Body...)
+		}
+	case *NodeFor:
+		body = n.Body
+	case *NodeBegin:
+		body = n.Body
+		if n.While != nil {
+			body = append(body[:len(body):len(body)], n.While.Body...)
+		}
+	case *NodeCollection:
+		body = n.Body
+	case *NodeQuotation:
+		body = n.Body
+	}
+	for _, c := range body {
+		inspect(c, f)
+	}
+}
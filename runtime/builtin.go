@@ -2,191 +2,439 @@ package runtime
 
 import (
 	"fmt"
-	"net"
+	"math"
+	"math/big"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/bruston/roost/types"
 )
 
-var Builtin = map[string]FuncValue{
-	"+": func(e *Env) {
-		n2, n1 := e.Stack.Pop(), e.Stack.Pop()
-		if n1.Type() == types.ValueNum && n2.Type() == types.ValueNum {
-			e.Stack.PushNum(n1.Value().(float64) + n2.Value().(float64))
-			return
+// stackIndex pops a non-negative integer and passes it to op, for pick and
+// roll.
+func stackIndex(e *Env, op func(n int)) error {
+	v := e.Stack.Pop()
+	n, ok := v.(types.IntValue)
+	if !ok {
+		return typeError(v, types.ValueInt)
+	}
+	if n.Val < 0 {
+		return &IndexError{Index: int(n.Val), Len: e.Stack.Len()}
+	}
+	if n.Val >= int64(e.Stack.Len()) {
+		return &StackUnderflowError{}
+	}
+	op(int(n.Val))
+	return nil
+}
+
+// checkIndex reports whether v is a valid index, or {start end} range, into a
+// value of the given size.
+func checkIndex(v Value, size int) error {
+	switch n := v.(type) {
+	case types.Number:
+		if i := int(n.Float()); i < 0 || i >= size {
+			return &IndexError{Index: i, Len: size}
 		}
-		if n1.Type() == types.ValueString && n2.Type() == types.ValueString {
-			e.Stack.PushString(n1.Value().(string) + n2.Value().(string))
+		return nil
+	case *types.SliceValue:
+		if len(n.Val) < 2 {
+			return &IndexError{Index: len(n.Val), Len: 2}
 		}
-	},
-	"*": func(e *Env) {
-		n2, n1 := e.Stack.Pop(), e.Stack.Pop()
-		if n1.Type() == types.ValueNum && n2.Type() == types.ValueNum {
-			e.Stack.PushNum(n1.Value().(float64) * n2.Value().(float64))
+		start, ok := n.Val[0].(types.Number)
+		if !ok {
+			return typeError(n.Val[0], types.ValueInt)
 		}
-	},
-	"-": func(e *Env) {
-		n2, n1 := e.Stack.Pop(), e.Stack.Pop()
-		if n1.Type() == types.ValueNum && n2.Type() == types.ValueNum {
-			e.Stack.PushNum(n1.Value().(float64) - n2.Value().(float64))
+		end, ok := n.Val[1].(types.Number)
+		if !ok {
+			return typeError(n.Val[1], types.ValueInt)
 		}
-	},
-	"/": func(e *Env) {
-		n2, n1 := e.Stack.Pop(), e.Stack.Pop()
-		if n1.Type() == types.ValueNum && n2.Type() == types.ValueNum {
-			e.Stack.PushNum(n1.Value().(float64) / n2.Value().(float64))
+		if i := int(end.Float()); i < 0 || i > size {
+			return &IndexError{Index: i, Len: size}
 		}
-	},
-	"%": func(e *Env) {
-		n2, n1 := e.Stack.Pop(), e.Stack.Pop()
-		if n1.Type() == types.ValueNum && n2.Type() == types.ValueNum {
-			e.Stack.PushNum(float64(int64(n1.Value().(float64)) % int64(n2.Value().(float64))))
+		if i := int(start.Float()); i < 0 || i > int(end.Float()) {
+			return &IndexError{Index: i, Len: size}
 		}
-	},
-	"dup":  func(e *Env) { e.Stack.Dup() },
-	"drop": func(e *Env) { e.Stack.Drop() },
-	".": func(e *Env) {
-		n := e.Stack.Pop()
-		if n == nil {
-			fmt.Fprintf(e.Stdout, "<nil>")
-			return
+		return nil
+	}
+	return typeError(v, types.ValueInt, types.ValueSlice)
+}
+
+var Builtin = map[string]FuncValue{
+	"+": arith{
+		int:  func(a, b int64) int64 { return a + b },
+		num:  func(a, b float64) float64 { return a + b },
+		big:  func(a, b *big.Int) *big.Int { return new(big.Int).Add(a, b) },
+		dec:  func(e *Env, a, b types.DecimalValue) types.DecimalValue { return a.Add(b) },
+		byte: func(a, b byte) byte { return a + b },
+		str:  func(a, b string) string { return a + b },
+	}.word,
+	"*": arith{
+		int:  func(a, b int64) int64 { return a * b },
+		num:  func(a, b float64) float64 { return a * b },
+		big:  func(a, b *big.Int) *big.Int { return new(big.Int).Mul(a, b) },
+		dec:  func(e *Env, a, b types.DecimalValue) types.DecimalValue { return a.Mul(b) },
+		byte: func(a, b byte) byte { return a * b },
+	}.word,
+	"-": arith{
+		int:  func(a, b int64) int64 { return a - b },
+		num:  func(a, b float64) float64 { return a - b },
+		big:  func(a, b *big.Int) *big.Int { return new(big.Int).Sub(a, b) },
+		dec:  func(e *Env, a, b types.DecimalValue) types.DecimalValue { return a.Sub(b) },
+		byte: func(a, b byte) byte { return a - b },
+	}.word,
+	"/": arith{
+		int:  func(a, b int64) int64 { return a / b },
+		num:  func(a, b float64) float64 { return a / b },
+		big:  func(a, b *big.Int) *big.Int { return new(big.Int).Quo(a, b) },
+		dec:  divideDecimals,
+		byte: func(a, b byte) byte { return a / b },
+		div:  true,
+	}.word,
+	"%": arith{
+		int:  func(a, b int64) int64 { return a % b },
+		num:  math.Mod,
+		big:  func(a, b *big.Int) *big.Int { return new(big.Int).Rem(a, b) },
+		dec:  func(e *Env, a, b types.DecimalValue) types.DecimalValue { return a.Rem(b) },
+		byte: func(a, b byte) byte { return a % b },
+		div:  true,
+	}.word,
+	"and": arith{
+		int:  func(a, b int64) int64 { return a & b },
+		big:  func(a, b *big.Int) *big.Int { return new(big.Int).And(a, b) },
+		byte: func(a, b byte) byte { return a & b },
+		bool: func(a, b bool) bool { return a && b },
+	}.word,
+	"or": arith{
+		int:  func(a, b int64) int64 { return a | b },
+		big:  func(a, b *big.Int) *big.Int { return new(big.Int).Or(a, b) },
+		byte: func(a, b byte) byte { return a | b },
+		bool: func(a, b bool) bool { return a || b },
+	}.word,
+	"xor": arith{
+		int:  func(a, b int64) int64 { return a ^ b },
+		big:  func(a, b *big.Int) *big.Int { return new(big.Int).Xor(a, b) },
+		byte: func(a, b byte) byte { return a ^ b },
+		bool: func(a, b bool) bool { return a != b },
+	}.word,
+	"not": func(e *Env) error {
+		switch v := e.Stack.Pop().(type) {
+		case types.IntValue:
+			e.Stack.PushInt(^v.Val)
+		case types.BigIntValue:
+			e.Stack.Push(types.NewBigInt(new(big.Int).Not(v.Val)))
+		case types.ByteValue:
+			e.Stack.PushByte(^v.Val)
+		case types.BoolValue:
+			e.Stack.PushBool(!v.Val)
+		default:
+			return typeError(v, types.ValueInt, types.ValueBigInt, types.ValueByte, types.ValueBool)
 		}
-		fmt.Fprintf(e.Stdout, "%s", n)
+		return nil
 	},
-	"LF":    func(e *Env) { e.Stack.PushString("\n") },
-	"CR":    func(e *Env) { e.Stack.PushString("\r") },
-	"true":  func(e *Env) { e.Stack.PushBool(true) },
-	"false": func(e *Env) { e.Stack.PushBool(false) },
-	"<": func(e *Env) {
-		n2, n1 := e.Stack.Pop(), e.Stack.Pop()
-		if n1.Type() != types.ValueNum || n2.Type() != types.ValueNum {
-			return
-		}
-		e.Stack.PushBool(n1.Value().(float64) < n2.Value().(float64))
+	"<<":    shift(true),
+	">>":    shift(false),
+	"dup":   func(e *Env) error { e.Stack.Dup(); return nil },
+	"drop":  func(e *Env) error { e.Stack.Drop(); return nil },
+	"over":  func(e *Env) error { e.Stack.Over(); return nil },
+	"rot":   func(e *Env) error { e.Stack.Rot(); return nil },
+	"-rot":  func(e *Env) error { e.Stack.RotBack(); return nil },
+	"nip":   func(e *Env) error { e.Stack.Nip(); return nil },
+	"tuck":  func(e *Env) error { e.Stack.Tuck(); return nil },
+	"pick":  func(e *Env) error { return stackIndex(e, e.Stack.Pick) },
+	"roll":  func(e *Env) error { return stackIndex(e, e.Stack.Roll) },
+	"2dup":  func(e *Env) error { e.Stack.TwoDup(); return nil },
+	"2drop": func(e *Env) error { e.Stack.TwoDrop(); return nil },
+	"2swap": func(e *Env) error { e.Stack.TwoSwap(); return nil },
+	"2over": func(e *Env) error { e.Stack.TwoOver(); return nil },
+	"depth": func(e *Env) error { e.Stack.PushInt(int64(e.Stack.Len())); return nil },
+	"clear": func(e *Env) error { e.Stack.Clear(); return nil },
+	".": func(e *Env) error {
+		fmt.Fprint(e.Stdout, show(e.Stack.Pop()))
+		return nil
 	},
-	">": func(e *Env) {
-		n2, n1 := e.Stack.Pop(), e.Stack.Pop()
-		if n1.Type() != types.ValueNum || n2.Type() != types.ValueNum {
-			return
-		}
-		e.Stack.PushBool(n1.Value().(float64) > n2.Value().(float64))
+	".s":     printStack,
+	"format": formatWord,
+	"fixed":  fixed,
+	"radix":  radix,
+
+	"LF":    func(e *Env) error { e.Stack.PushString("\n"); return nil },
+	"CR":    func(e *Env) error { e.Stack.PushString("\r"); return nil },
+	"true":  func(e *Env) error { e.Stack.PushBool(true); return nil },
+	"false": func(e *Env) error { e.Stack.PushBool(false); return nil },
+	"<":     comparison(func(c int) bool { return c < 0 }),
+	">":     comparison(func(c int) bool { return c > 0 }),
+	"<=":    comparison(func(c int) bool { return c <= 0 }),
+	">=":    comparison(func(c int) bool { return c >= 0 }),
+	"=": func(e *Env) error {
+		e.Stack.PushBool(types.Equal(e.Stack.Pop(), e.Stack.Pop()))
+		return nil
 	},
-	"=": func(e *Env) {
-		e.Stack.PushBool(e.Stack.Pop().Value() == e.Stack.Pop().Value())
+	"<>": func(e *Env) error {
+		e.Stack.PushBool(!types.Equal(e.Stack.Pop(), e.Stack.Pop()))
+		return nil
 	},
-	"!": func(e *Env) {
-		val, name := e.Stack.Pop(), e.Stack.Pop()
-		if ref, ok := name.(types.RefValue); ok {
-			e.Vars[ref.Key] = val
+	">num":   toNum,
+	">str":   toStr,
+	">bool":  toBool,
+	">blob":  toBlob,
+	">slice": toSlice,
+	"type":   typeName,
+
+	"is-num?":       isType(types.ValueInt, types.ValueNum, types.ValueBigInt, types.ValueDecimal),
+	"is-int?":       isType(types.ValueInt),
+	"is-float?":     isType(types.ValueNum),
+	"is-bigint?":    isType(types.ValueBigInt),
+	"is-decimal?":   isType(types.ValueDecimal),
+	"is-string?":    isType(types.ValueString),
+	"is-byte?":      isType(types.ValueByte),
+	"is-bool?":      isType(types.ValueBool),
+	"is-slice?":     isType(types.ValueSlice),
+	"is-blob?":      isType(types.ValueBlob),
+	"is-map?":       isType(types.ValueMap),
+	"is-quotation?": isType(types.ValueQuotation),
+	"is-pipe?":      isType(types.ValuePipe),
+	"is-listener?":  isType(types.ValueListener),
+
+	">byte": func(e *Env) error {
+		switch v := e.Stack.Pop().(type) {
+		case types.ByteValue:
+			e.Stack.Push(v)
+		case types.Number:
+			if f := v.Float(); f != float64(byte(f)) {
+				return &ConversionError{Value: fmt.Sprint(v), To: types.ValueByte}
+			}
+			e.Stack.PushByte(byte(v.Float()))
+		default:
+			return typeError(v, types.ValueInt, types.ValueNum, types.ValueByte)
 		}
+		return nil
 	},
-	"@": func(e *Env) {
-		if ref, ok := e.Stack.Pop().(types.RefValue); ok {
-			e.Stack.Push(e.Vars[ref.Key])
+	"byte>num": func(e *Env) error {
+		v := e.Stack.Pop()
+		b, ok := v.(types.ByteValue)
+		if !ok {
+			return typeError(v, types.ValueByte)
 		}
+		e.Stack.PushInt(int64(b.Val))
+		return nil
 	},
-	"swap": func(e *Env) {
-		e.Stack.Swap()
-	},
-	"I": func(e *Env) { e.Stack.Push(e.Return.Peek()) },
-	"insert": func(e *Env) {
-		val := e.Stack.Pop()
-		if collection, ok := e.Stack.Peek().(types.Collection); ok {
-			collection.Insert(val)
+	">bigint": func(e *Env) error {
+		switch v := e.Stack.Pop().(type) {
+		case types.IntValue:
+			e.Stack.Push(types.NewBigInt(big.NewInt(v.Val)))
+		case types.BigIntValue:
+			e.Stack.Push(v)
+		case types.DecimalValue:
+			e.Stack.Push(types.NewBigInt(v.Round(0, e.Rounding).Unscaled))
+		case types.NumValue:
+			f := new(big.Float).SetFloat64(v.Val)
+			n, acc := f.Int(nil)
+			if acc != big.Exact {
+				return &ConversionError{Value: v.String(), To: types.ValueBigInt}
+			}
+			e.Stack.Push(types.NewBigInt(n))
+		case types.StringValue:
+			n, ok := new(big.Int).SetString(strings.ReplaceAll(v.Val, "_", ""), 10)
+			if !ok {
+				return &ConversionError{Value: strconv.Quote(v.Val), To: types.ValueBigInt}
+			}
+			e.Stack.Push(types.NewBigInt(n))
+		default:
+			return typeError(v, types.ValueInt, types.ValueNum, types.ValueBigInt, types.ValueDecimal, types.ValueString)
 		}
+		return nil
 	},
-	"open": func(e *Env) {
-		name, ok := e.Stack.Pop().(types.StringValue)
-		if !ok {
-			return
-		}
-		file, err := os.Open(name.Val)
-		if err != nil {
-			e.Stack.PushNum(1)
-			return
+	">decimal": func(e *Env) error {
+		switch v := e.Stack.Pop().(type) {
+		case types.IntValue, types.BigIntValue:
+			e.Stack.Push(toDecimal(v.(types.Number)))
+		case types.DecimalValue:
+			e.Stack.Push(v)
+		case types.NumValue:
+			// the shortest decimal that converts back to the same float
+			d, err := types.ParseDecimal(strconv.FormatFloat(v.Val, 'f', -1, 64))
+			if err != nil {
+				return &ConversionError{Value: v.String(), To: types.ValueDecimal}
+			}
+			e.Stack.Push(d)
+		case types.StringValue:
+			d, err := types.ParseDecimal(v.Val)
+			if err != nil {
+				return &ConversionError{Value: strconv.Quote(v.Val), To: types.ValueDecimal}
+			}
+			e.Stack.Push(d)
+		default:
+			return typeError(v, types.ValueInt, types.ValueNum, types.ValueBigInt, types.ValueDecimal, types.ValueString)
 		}
-		pipe := &types.PipeValue{types.ValuePipe, file}
-		e.Stack.Push(pipe)
-		e.Stack.PushNum(0)
+		return nil
 	},
-	"dial": func(e *Env) {
-		addr, ok := e.Stack.Pop().(types.StringValue)
+	"round": func(e *Env) error {
+		v2, v1 := e.Stack.Pop(), e.Stack.Pop()
+		places, ok := v2.(types.IntValue)
 		if !ok {
-			return
+			return typeError(v2, types.ValueInt)
 		}
-		prot, ok := e.Stack.Pop().(types.StringValue)
+		d, ok := v1.(types.DecimalValue)
 		if !ok {
-			return
+			return typeError(v1, types.ValueDecimal)
+		}
+		if places.Val < 0 {
+			return &IndexError{Index: int(places.Val), Len: 0}
 		}
-		conn, err := net.Dial(prot.Val, addr.Val)
-		if err != nil {
-			e.Stack.PushString(err.Error())
-			e.Stack.PushNum(1)
-			return
+		if places.Val > types.MaxDecimalPlaces {
+			return ErrTooManyPlaces
 		}
-		pipe := &types.PipeValue{types.ValuePipe, conn}
-		e.Stack.Push(pipe)
-		e.Stack.PushNum(0)
+		e.Stack.Push(d.Round(int(places.Val), e.Rounding))
+		return nil
 	},
-	"send": func(e *Env) {
-		payload := e.Stack.Pop()
-		p, ok := e.Stack.Peek().(*types.PipeValue)
+	"rounding": func(e *Env) error {
+		v := e.Stack.Pop()
+		name, ok := v.(types.StringValue)
 		if !ok {
-			return
+			return typeError(v, types.ValueString)
 		}
-		n, err := p.Write(payload)
-		if err != nil {
-			e.Stack.PushString(err.Error())
-			e.Stack.PushNum(1)
-			return
+		mode, ok := types.ParseRoundingMode(name.Val)
+		if !ok {
+			return fmt.Errorf("unknown rounding mode %q", name.Val)
 		}
-		e.Stack.PushNum(n)
-		e.Stack.PushNum(0)
+		e.Rounding = mode
+		return nil
 	},
-	"close": func(e *Env) {
-		pipe, ok := e.Stack.Peek().(*types.PipeValue)
+	"!": func(e *Env) error {
+		val, name := e.Stack.Pop(), e.Stack.Pop()
+		ref, ok := name.(types.RefValue)
 		if !ok {
-			return
+			return typeError(name, types.ValueRef)
 		}
-		if err := pipe.Close(); err != nil {
-			e.Stack.PushString(err.Error())
-			e.Stack.PushNum(1)
-			return
-		}
-		e.Stack.PushNum(0)
-		e.Stack.Drop()
+		e.Vars[ref.Key] = val
+		return nil
 	},
-	"recv": func(e *Env) {
-		arg, ok := e.Stack.Pop().(types.NumValue)
+	"@": func(e *Env) error {
+		v := e.Stack.Pop()
+		ref, ok := v.(types.RefValue)
 		if !ok {
-			return
+			return typeError(v, types.ValueRef)
+		}
+		e.Stack.Push(e.Vars[ref.Key])
+		return nil
+	},
+	"swap": func(e *Env) error {
+		e.Stack.Swap()
+		return nil
+	},
+	">r": func(e *Env) error { e.Return.Push(e.Stack.Pop()); return nil },
+	"r>": func(e *Env) error { e.Stack.Push(e.Return.Pop()); return nil },
+	"r@": func(e *Env) error { e.Stack.Push(e.Return.Peek()); return nil },
+	// a loop keeps its limit and index on the return stack, the index on top
+	"I": func(e *Env) error { e.Stack.Push(e.Return.Peek()); return nil },
+	"J": func(e *Env) error { e.Stack.Push(e.Return.At(2)); return nil },
+	"K": func(e *Env) error { e.Stack.Push(e.Return.At(4)); return nil },
+
+	"call": func(e *Env) error { return e.CallQuotation() },
+
+	"get":    mapGet,
+	"put":    mapPut,
+	"has":    mapHas,
+	"delete": mapDelete,
+	"keys":   mapKeys,
+	"values": mapValues,
+
+	"substring":    substring,
+	"index-of":     indexOf,
+	"split":        split,
+	"join":         join,
+	"trim":         stringFunc(strings.TrimSpace),
+	"upper":        stringFunc(strings.ToUpper),
+	"lower":        stringFunc(strings.ToLower),
+	"replace":      replace,
+	"starts-with?": stringTest(strings.HasPrefix),
+	"ends-with?":   stringTest(strings.HasSuffix),
+	"contains?":    stringTest(strings.Contains),
+	"replicate":    replicate,
+
+	"each":    each,
+	"map":     mapElems,
+	"filter":  filter,
+	"reduce":  reduce,
+	"sort-by": sortBy,
+	"reverse": reverse,
+	"any": search(true, func(e *Env, elem types.Value, ok bool) {
+		e.Stack.PushBool(ok)
+	}),
+	"all": search(false, func(e *Env, elem types.Value, ok bool) {
+		e.Stack.PushBool(!ok)
+	}),
+	"find": search(true, func(e *Env, elem types.Value, ok bool) {
+		if ok {
+			e.Stack.Push(elem)
 		}
-		pipe, ok := e.Stack.Peek().(*types.PipeValue)
+		e.Stack.PushBool(ok)
+	}),
+	"insert": func(e *Env) error {
+		val := e.Stack.Pop()
+		collection, ok := e.Stack.Peek().(types.Collection)
 		if !ok {
-			return
+			return typeError(e.Stack.Peek(), types.ValueSlice, types.ValueBlob)
 		}
-		b := make([]byte, 0, int(arg.Val))
-		n, err := pipe.Read(b)
-		if err != nil {
-			e.Stack.PushString(err.Error())
-			e.Stack.PushNum(1)
-			return
+		if _, ok := collection.(*types.BlobValue); ok && types.TypeOf(val) != types.ValueByte {
+			return typeError(val, types.ValueByte)
 		}
-		e.Stack.PushBlob(b)
-		e.Stack.PushNum(n)
-		e.Stack.PushNum(0)
+		collection.Insert(val)
+		return nil
 	},
-	"#": func(e *Env) {
+	"open":        openWith(fileModes["r"]),
+	"create":      openWith(fileModes["w+"]),
+	"open-append": openWith(fileModes["a"]),
+	"open-mode":   openMode,
+	"exists?":     exists,
+	"remove":      pathFunc(os.Remove),
+	"rename":      rename,
+	"mkdir":       pathFunc(makeDir),
+	"list-dir":    listDir,
+	"stat":        stat,
+
+	"stdin":           stdin,
+	"key":             key,
+	"read-stdin-line": readStdinLine,
+	"stdin-lines":     stdinLines,
+
+	"dial":      dial,
+	"send":      send,
+	"close":     closeValue,
+	"recv":      recv,
+	"read-n":    readN,
+	"read-all":  readAll,
+	"read-line": readLine,
+
+	"listen":        listen,
+	"accept":        accept,
+	"listener-addr": listenerAddr,
+
+	"#": func(e *Env) error {
+		if _, ok := e.Stack.At(1).(*types.MapValue); ok {
+			return mapGet(e)
+		}
 		v := e.Stack.Pop()
-		if indexable, ok := e.Stack.Peek().(types.Indexable); ok {
-			e.Stack.Push(indexable.Index(v))
+		indexable, ok := e.Stack.Peek().(types.Indexable)
+		if !ok {
+			return typeError(e.Stack.Peek(), types.ValueSlice, types.ValueBlob, types.ValueString, types.ValueMap)
+		}
+		if sizer, ok := indexable.(types.Sizer); ok {
+			if err := checkIndex(v, sizer.Len()); err != nil {
+				return err
+			}
 		}
+		e.Stack.Push(indexable.Index(v))
+		return nil
 	},
-	"len": func(e *Env) {
+	"len": func(e *Env) error {
 		sizer, ok := e.Stack.Peek().(types.Sizer)
 		if !ok {
-			return
+			return typeError(e.Stack.Peek(), types.ValueString, types.ValueSlice, types.ValueBlob, types.ValueMap)
 		}
-		e.Stack.Push(types.NewNum(float64(sizer.Len())))
+		e.Stack.PushInt(int64(sizer.Len()))
+		return nil
 	},
 }
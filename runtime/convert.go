@@ -0,0 +1,167 @@
+package runtime
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bruston/roost/types"
+)
+
+// toNum is >num ( value -- number ). Strings are parsed as an integer, which
+// may have a 0x, 0o or 0b base prefix, or failing that a finite float. Bytes
+// become integers and numbers are left as they are.
+func toNum(e *Env) error {
+	switch v := e.Stack.Pop().(type) {
+	case types.Number:
+		e.Stack.Push(v)
+	case types.ByteValue:
+		e.Stack.PushInt(int64(v.Val))
+	case types.StringValue:
+		n, err := parseNum(strings.TrimSpace(v.Val))
+		if err != nil {
+			return &ConversionError{Value: strconv.Quote(v.Val), To: types.ValueNum}
+		}
+		e.Stack.Push(n)
+	default:
+		return typeError(v, types.ValueInt, types.ValueNum, types.ValueBigInt, types.ValueDecimal, types.ValueByte, types.ValueString)
+	}
+	return nil
+}
+
+// parseNum parses s as an integer or float.
+func parseNum(s string) (Value, error) {
+	digits := strings.TrimLeft(s, "+-")
+	base := 10
+	if len(digits) > 1 && digits[0] == '0' && strings.ContainsRune("xXoObB", rune(digits[1])) {
+		base = 0
+	}
+	i, err := strconv.ParseInt(s, base, 64)
+	if err == nil {
+		return types.NewInt(i), nil
+	}
+	if base == 0 || errors.Is(err, strconv.ErrRange) {
+		return nil, err
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, err
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, strconv.ErrSyntax
+	}
+	return types.NewNum(f), nil
+}
+
+// toStr is >str ( value -- string ), the value as . prints it. A blob's
+// bytes become the string.
+func toStr(e *Env) error {
+	switch v := e.Stack.Pop().(type) {
+	case *types.BlobValue:
+		e.Stack.PushString(string(v.Val))
+	default:
+		e.Stack.PushString(show(v))
+	}
+	return nil
+}
+
+// toBool is >bool ( value -- bool ). The strings "true" and "false" convert
+// to their bools and numbers and bytes are true if they are not zero.
+func toBool(e *Env) error {
+	switch v := e.Stack.Pop().(type) {
+	case types.BoolValue:
+		e.Stack.Push(v)
+	case types.StringValue:
+		switch v.Val {
+		case "true":
+			e.Stack.PushBool(true)
+		case "false":
+			e.Stack.PushBool(false)
+		default:
+			return &ConversionError{Value: strconv.Quote(v.Val), To: types.ValueBool}
+		}
+	case types.ByteValue:
+		e.Stack.PushBool(v.Val != 0)
+	case types.Number:
+		e.Stack.PushBool(v.Float() != 0)
+	default:
+		return typeError(v, types.ValueBool, types.ValueString, types.ValueInt, types.ValueNum, types.ValueBigInt, types.ValueDecimal, types.ValueByte)
+	}
+	return nil
+}
+
+// toBlob is >blob ( value -- blob ), the bytes of a string, a byte on its
+// own or a slice of bytes and integers from 0 to 255.
+func toBlob(e *Env) error {
+	var b []byte
+	switch v := e.Stack.Pop().(type) {
+	case *types.BlobValue:
+		b = append(b, v.Val...)
+	case types.StringValue:
+		b = []byte(v.Val)
+	case types.ByteValue:
+		b = []byte{v.Val}
+	case *types.SliceValue:
+		b = make([]byte, len(v.Val))
+		for i, elem := range v.Val {
+			switch n := elem.(type) {
+			case types.ByteValue:
+				b[i] = n.Val
+			case types.IntValue:
+				if n.Val < 0 || n.Val > 255 {
+					return &ConversionError{Value: n.String(), To: types.ValueByte}
+				}
+				b[i] = byte(n.Val)
+			default:
+				return typeError(elem, types.ValueByte, types.ValueInt)
+			}
+		}
+	default:
+		return typeError(v, types.ValueBlob, types.ValueString, types.ValueByte, types.ValueSlice)
+	}
+	e.Stack.PushBlob(b)
+	return nil
+}
+
+// toSlice is >slice ( collection -- slice ), the elements of a collection as
+// the collection words see them.
+func toSlice(e *Env) error {
+	v := e.Stack.Pop()
+	it, ok := v.(types.Iterable)
+	if !ok {
+		return typeError(v, iterable...)
+	}
+	elems := []types.Value{}
+	it.Iter(func(elem types.Value) bool {
+		elems = append(elems, elem)
+		return true
+	})
+	if err := iterErr(v); err != nil {
+		return err
+	}
+	e.Stack.Push(&types.SliceValue{types.ValueSlice, elems})
+	return nil
+}
+
+// typeName is type ( value -- string ), the name of the value's type.
+func typeName(e *Env) error {
+	e.Stack.PushString(types.TypeOf(e.Stack.Pop()).Name())
+	return nil
+}
+
+// isType returns a word ( value -- bool ) pushing whether the value is one
+// of the given types.
+func isType(t ...types.ValueType) FuncValue {
+	return func(e *Env) error {
+		v := e.Stack.Pop()
+		for _, want := range t {
+			if types.TypeOf(v) == want {
+				e.Stack.PushBool(true)
+				return nil
+			}
+		}
+		e.Stack.PushBool(false)
+		return nil
+	}
+}
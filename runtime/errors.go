@@ -0,0 +1,111 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bruston/roost/types"
+)
+
+// ErrStackError is matched, using errors.Is, by both StackUnderflowError and
+// StackOverflowError.
+var ErrStackError = errors.New("stack under/overflow")
+
+var (
+	ErrDivisionByZero = errors.New("division by zero")
+	ErrNegativeShift  = errors.New("negative shift count")
+	ErrShiftTooLarge  = fmt.Errorf("shift count too large, big integers shift left by at most %d", MaxBigIntShift)
+	ErrTooManyPlaces  = fmt.Errorf("too many decimal places, at most %d", types.MaxDecimalPlaces)
+	ErrStringTooLong  = fmt.Errorf("string too long, replicate makes at most %d bytes", MaxReplicateLen)
+	ErrZeroStep       = errors.New("loop step must not be zero")
+	ErrBase           = errors.New("base must be from 2 to 36")
+)
+
+// TypeError is returned when a word finds a value of the wrong type on the
+// stack.
+type TypeError struct {
+	Expected []types.ValueType
+	Actual   types.ValueType
+}
+
+func (e *TypeError) Error() string {
+	names := make([]string, len(e.Expected))
+	for i, t := range e.Expected {
+		names[i] = t.Name()
+	}
+	return fmt.Sprintf("type mismatch: expected %s, got %s", strings.Join(names, " or "), e.Actual.Name())
+}
+
+func typeError(actual Value, expected ...types.ValueType) error {
+	return &TypeError{Expected: expected, Actual: types.TypeOf(actual)}
+}
+
+// StackUnderflowError is raised when popping from or peeking at an empty stack.
+type StackUnderflowError struct{}
+
+func (e *StackUnderflowError) Error() string { return "stack underflow" }
+
+func (e *StackUnderflowError) Is(target error) bool { return target == ErrStackError }
+
+// StackOverflowError is raised when pushing to a full stack, Depth is the
+// number of values the stack held.
+type StackOverflowError struct{ Depth int }
+
+func (e *StackOverflowError) Error() string {
+	return fmt.Sprintf("stack overflow at depth %d", e.Depth)
+}
+
+func (e *StackOverflowError) Is(target error) bool { return target == ErrStackError }
+
+// ReturnStackError is returned when a word or loop body finishes with more or
+// fewer values on the return stack than it started with, Delta is the
+// difference.
+type ReturnStackError struct{ Delta int }
+
+func (e *ReturnStackError) Error() string {
+	if e.Delta < 0 {
+		return fmt.Sprintf("unbalanced return stack: %d values removed", -e.Delta)
+	}
+	return fmt.Sprintf("unbalanced return stack: %d values left", e.Delta)
+}
+
+// UndefinedWordError is returned for a word with no definition.
+type UndefinedWordError struct{ Word string }
+
+func (e *UndefinedWordError) Error() string { return fmt.Sprintf("undefined word %q", e.Word) }
+
+// IndexError is returned when indexing outside the bounds of a value.
+type IndexError struct {
+	Index int
+	Len   int
+}
+
+func (e *IndexError) Error() string {
+	return fmt.Sprintf("index %d out of range with length %d", e.Index, e.Len)
+}
+
+// KeyError is returned when looking up a key that is not in a map.
+type KeyError struct{ Key string }
+
+func (e *KeyError) Error() string { return fmt.Sprintf("key %s not found", e.Key) }
+
+// ConversionError is returned when a value cannot be converted to the type a
+// word asks for.
+type ConversionError struct {
+	Value string
+	To    types.ValueType
+}
+
+func (e *ConversionError) Error() string {
+	return fmt.Sprintf("cannot convert %s to %s", e.Value, e.To.Name())
+}
+
+// FormatError is returned by format when a template doesn't match its
+// arguments.
+type FormatError struct {
+	Template string
+	Reason   string
+}
+
+func (e *FormatError) Error() string { return fmt.Sprintf("format %q: %s", e.Template, e.Reason) }
@@ -0,0 +1,170 @@
+package runtime
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/bruston/roost/types"
+)
+
+// ErrFileMode is returned by open-mode for a mode it doesn't know.
+var ErrFileMode = errors.New("file mode must be one of r, w, a, r+, w+ or a+")
+
+// fileModes are the modes open-mode accepts, as in C's fopen.
+var fileModes = map[string]int{
+	"r":  os.O_RDONLY,
+	"w":  os.O_WRONLY | os.O_CREATE | os.O_TRUNC,
+	"a":  os.O_WRONLY | os.O_CREATE | os.O_APPEND,
+	"r+": os.O_RDWR,
+	"w+": os.O_RDWR | os.O_CREATE | os.O_TRUNC,
+	"a+": os.O_RDWR | os.O_CREATE | os.O_APPEND,
+}
+
+// Path returns the file a path given by a script refers to. Without a Root
+// paths are used as they are. With one they are taken relative to Root,
+// absolute paths included, and .. never leads above it, though symbolic links
+// within Root are followed wherever they point.
+func (e *Env) Path(name string) string {
+	if e.Root == "" {
+		return name
+	}
+	return filepath.Join(e.Root, filepath.Clean(string(filepath.Separator)+name))
+}
+
+// fileError returns err naming the path as the script gave it rather than
+// where it is under Root.
+func fileError(err error, name string) error {
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return &os.PathError{Op: pe.Op, Path: name, Err: pe.Err}
+	}
+	return err
+}
+
+// openWith returns a word ( path -- pipe 0 | msg 1 ) opening a file with
+// the given os.OpenFile flags.
+func openWith(flag int) FuncValue {
+	return func(e *Env) error {
+		name, err := popString(e)
+		if err != nil {
+			return err
+		}
+		return openFile(e, name, flag)
+	}
+}
+
+func openFile(e *Env, name string, flag int) error {
+	file, err := os.OpenFile(e.Path(name), flag, 0666)
+	if err != nil {
+		pushStatus(e, fileError(err, name))
+		return nil
+	}
+	e.Stack.Push(types.NewPipe(file))
+	pushStatus(e, nil)
+	return nil
+}
+
+// openMode is open-mode ( path mode -- pipe 0 | msg 1 ), see fileModes.
+func openMode(e *Env) error {
+	s, err := popStrings(e, 2)
+	if err != nil {
+		return err
+	}
+	flag, ok := fileModes[s[1]]
+	if !ok {
+		return ErrFileMode
+	}
+	return openFile(e, s[0], flag)
+}
+
+// exists is exists? ( path -- bool ).
+func exists(e *Env) error {
+	name, err := popString(e)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(e.Path(name))
+	e.Stack.PushBool(err == nil)
+	return nil
+}
+
+// pathFunc returns a word ( path -- 0 | msg 1 ) calling f with the file a
+// path refers to.
+func pathFunc(f func(string) error) FuncValue {
+	return func(e *Env) error {
+		name, err := popString(e)
+		if err != nil {
+			return err
+		}
+		if err := f(e.Path(name)); err != nil {
+			pushStatus(e, fileError(err, name))
+			return nil
+		}
+		pushStatus(e, nil)
+		return nil
+	}
+}
+
+// makeDir creates a directory and any missing parents.
+func makeDir(name string) error { return os.MkdirAll(name, 0777) }
+
+// rename is rename ( old new -- 0 | msg 1 ).
+func rename(e *Env) error {
+	s, err := popStrings(e, 2)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(e.Path(s[0]), e.Path(s[1]))
+	var le *os.LinkError
+	if errors.As(err, &le) {
+		err = &os.LinkError{Op: le.Op, Old: s[0], New: s[1], Err: le.Err}
+	}
+	pushStatus(e, err)
+	return nil
+}
+
+// listDir is list-dir ( path -- slice 0 | msg 1 ), the names in a directory
+// in order.
+func listDir(e *Env) error {
+	name, err := popString(e)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(e.Path(name))
+	if err != nil {
+		pushStatus(e, fileError(err, name))
+		return nil
+	}
+	names := make([]types.Value, len(entries))
+	for i, entry := range entries {
+		names[i] = types.NewString(entry.Name())
+	}
+	e.Stack.Push(&types.SliceValue{types.ValueSlice, names})
+	pushStatus(e, nil)
+	return nil
+}
+
+// stat is stat ( path -- map 0 | msg 1 ), a map of a file's name, size,
+// whether it is a directory, its permissions and its modification time in
+// seconds since the Unix epoch.
+func stat(e *Env) error {
+	name, err := popString(e)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(e.Path(name))
+	if err != nil {
+		pushStatus(e, fileError(err, name))
+		return nil
+	}
+	m := types.NewMap()
+	m.Put(types.NewString("name"), types.NewString(fi.Name()))
+	m.Put(types.NewString("size"), types.NewInt(fi.Size()))
+	m.Put(types.NewString("dir"), types.NewBool(fi.IsDir()))
+	m.Put(types.NewString("mode"), types.NewString(fi.Mode().String()))
+	m.Put(types.NewString("modified"), types.NewInt(fi.ModTime().Unix()))
+	e.Stack.Push(m)
+	pushStatus(e, nil)
+	return nil
+}
@@ -0,0 +1,239 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bruston/roost/types"
+)
+
+// show returns v as . prints it.
+func show(v Value) string { return types.Format(v) }
+
+// printStack is .s ( -- ), printing the depth of the stack then its values
+// from the bottom up, leaving the stack as it was.
+func printStack(e *Env) error {
+	n := e.Stack.Len()
+	fmt.Fprintf(e.Stdout, "<%d>", n)
+	for i := n - 1; i >= 0; i-- {
+		io.WriteString(e.Stdout, " "+show(e.Stack.At(i)))
+	}
+	return nil
+}
+
+// formatWord is format ( template slice -- s ), see formatString.
+func formatWord(e *Env) error {
+	v := e.Stack.Pop()
+	args, ok := v.(*types.SliceValue)
+	if !ok {
+		return typeError(v, types.ValueSlice)
+	}
+	tmpl, err := popString(e)
+	if err != nil {
+		return err
+	}
+	s, err := formatString(e, tmpl, args.Val)
+	if err != nil {
+		return err
+	}
+	e.Stack.PushString(s)
+	return nil
+}
+
+// formatString replaces each verb in tmpl with the next of args formatted by
+// it. Verbs are written as in Go's fmt package: a %, optional flags, width
+// and precision, then a letter. Each argument must be used exactly once.
+func formatString(e *Env, tmpl string, args []types.Value) (string, error) {
+	var b strings.Builder
+	used := 0
+	for i := 0; i < len(tmpl); i++ {
+		if tmpl[i] != '%' {
+			b.WriteByte(tmpl[i])
+			continue
+		}
+		j := i + 1
+		for j < len(tmpl) && strings.IndexByte("+- #0123456789.", tmpl[j]) >= 0 {
+			j++
+		}
+		if j == len(tmpl) {
+			return "", &FormatError{Template: tmpl, Reason: "missing verb at end of template"}
+		}
+		spec, verb := tmpl[i:j], tmpl[j]
+		i = j
+		if verb == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		if tooLarge(spec) {
+			return "", &FormatError{Template: tmpl, Reason: fmt.Sprintf("width or precision too large in %s%c", spec, verb)}
+		}
+		if used == len(args) {
+			return "", &FormatError{Template: tmpl, Reason: fmt.Sprintf("missing argument for %s%c", spec, verb)}
+		}
+		s, err := formatValue(e, spec, verb, args[used])
+		if err != nil {
+			if err == errUnknownVerb {
+				return "", &FormatError{Template: tmpl, Reason: fmt.Sprintf("unknown verb %s%c", spec, verb)}
+			}
+			return "", err
+		}
+		b.WriteString(s)
+		used++
+	}
+	if used < len(args) {
+		return "", &FormatError{Template: tmpl, Reason: fmt.Sprintf("too many arguments, %d unused", len(args)-used)}
+	}
+	return b.String(), nil
+}
+
+var errUnknownVerb = errors.New("unknown verb")
+
+// maxWidth is the largest width or precision a verb may have, as in Go's fmt
+// package.
+const maxWidth = 1000000
+
+// tooLarge reports whether the width or precision in a verb's spec is over
+// maxWidth.
+func tooLarge(spec string) bool {
+	for _, digits := range strings.FieldsFunc(spec, func(r rune) bool { return r < '0' || r > '9' }) {
+		if n, err := strconv.Atoi(digits); err != nil || n > maxWidth {
+			return true
+		}
+	}
+	return false
+}
+
+// formatValue formats v with a single verb, spec is the verb's % and any
+// flags, width and precision.
+func formatValue(e *Env, spec string, verb byte, v Value) (string, error) {
+	switch verb {
+	case 's', 'v':
+		return fmt.Sprintf(spec+"s", show(v)), nil
+	case 'q':
+		return fmt.Sprintf(spec+"q", show(v)), nil
+	case 'd', 'o', 'b', 'c', 'x', 'X':
+		switch n := v.(type) {
+		case types.IntValue:
+			return fmt.Sprintf(spec+string(verb), n.Val), nil
+		case types.ByteValue:
+			return fmt.Sprintf(spec+string(verb), n.Val), nil
+		case types.BigIntValue:
+			if verb != 'c' {
+				return fmt.Sprintf(spec+string(verb), n.Val), nil
+			}
+		case types.StringValue:
+			if verb == 'x' || verb == 'X' {
+				return fmt.Sprintf(spec+string(verb), n.Val), nil
+			}
+		case *types.BlobValue:
+			if verb == 'x' || verb == 'X' {
+				return fmt.Sprintf(spec+string(verb), n.Val), nil
+			}
+		}
+		if verb == 'x' || verb == 'X' {
+			return "", typeError(v, types.ValueInt, types.ValueBigInt, types.ValueByte, types.ValueString, types.ValueBlob)
+		}
+		return "", typeError(v, types.ValueInt, types.ValueBigInt, types.ValueByte)
+	case 'f', 'e', 'E', 'g', 'G':
+		n, ok := v.(types.Number)
+		if !ok {
+			return "", typeError(v, types.ValueInt, types.ValueNum, types.ValueBigInt, types.ValueDecimal)
+		}
+		if d, ok := n.(types.DecimalValue); ok && verb == 'f' {
+			return formatDecimal(e, spec, d), nil
+		}
+		return fmt.Sprintf(spec+string(verb), n.Float()), nil
+	}
+	return "", errUnknownVerb
+}
+
+// formatDecimal formats a decimal for %f exactly, rounding it to the
+// precision, 6 places if there is none, using Env.Rounding.
+func formatDecimal(e *Env, spec string, d types.DecimalValue) string {
+	rest := strings.TrimLeft(spec[1:], "+- #0")
+	flags := spec[1 : len(spec)-len(rest)]
+	places := 6
+	if i := strings.IndexByte(rest, '.'); i >= 0 {
+		places, _ = strconv.Atoi(rest[i+1:])
+		rest = rest[:i]
+	}
+	width, _ := strconv.Atoi(rest)
+	s := d.Round(places, e.Rounding).String()
+	if d.Unscaled.Sign() >= 0 {
+		switch {
+		case strings.Contains(flags, "+"):
+			s = "+" + s
+		case strings.Contains(flags, " "):
+			s = " " + s
+		}
+	}
+	if len(s) >= width {
+		return s
+	}
+	padding := width - len(s)
+	switch {
+	case strings.Contains(flags, "-"):
+		return s + strings.Repeat(" ", padding)
+	case strings.Contains(flags, "0"):
+		sign := ""
+		if s[0] == '-' || s[0] == '+' || s[0] == ' ' {
+			sign, s = s[:1], s[1:]
+		}
+		return sign + strings.Repeat("0", padding) + s
+	}
+	return strings.Repeat(" ", padding) + s
+}
+
+// fixed is fixed ( number places -- s ), the number with places digits after
+// the decimal point. Integers and decimals are rounded exactly using
+// Env.Rounding.
+func fixed(e *Env) error {
+	places, err := popInt(e)
+	if err != nil {
+		return err
+	}
+	v := e.Stack.Pop()
+	n, ok := v.(types.Number)
+	if !ok {
+		return typeError(v, types.ValueInt, types.ValueNum, types.ValueBigInt, types.ValueDecimal)
+	}
+	if places < 0 {
+		return &IndexError{Index: int(places), Len: 0}
+	}
+	if places > types.MaxDecimalPlaces {
+		return ErrTooManyPlaces
+	}
+	if f, ok := n.(types.NumValue); ok {
+		e.Stack.PushString(strconv.FormatFloat(f.Val, 'f', int(places), 64))
+		return nil
+	}
+	e.Stack.PushString(toDecimal(n).Round(int(places), e.Rounding).String())
+	return nil
+}
+
+// radix is radix ( integer base -- s ), the integer written in a base from 2
+// to 36.
+func radix(e *Env) error {
+	base, err := popInt(e)
+	if err != nil {
+		return err
+	}
+	v := e.Stack.Pop()
+	if base < 2 || base > 36 {
+		return ErrBase
+	}
+	switch n := v.(type) {
+	case types.IntValue:
+		e.Stack.PushString(strconv.FormatInt(n.Val, int(base)))
+	case types.BigIntValue:
+		e.Stack.PushString(n.Val.Text(int(base)))
+	case types.ByteValue:
+		e.Stack.PushString(strconv.FormatUint(uint64(n.Val), int(base)))
+	default:
+		return typeError(v, types.ValueInt, types.ValueBigInt, types.ValueByte)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bruston/roost/types"
+)
+
+// The words in this file call a quotation for each element of a collection,
+// taking the collection and then the quotation from the stack.
+
+// popCode pops a quotation and returns its code.
+func popCode(e *Env) (Code, error) {
+	v := e.Stack.Pop()
+	q, ok := v.(types.QuotationValue)
+	if !ok {
+		return nil, typeError(v, types.ValueQuotation)
+	}
+	code, ok := q.Code.(Code)
+	if !ok {
+		return nil, fmt.Errorf("quotation %s cannot be called", q)
+	}
+	return code, nil
+}
+
+// iterable are the types the collection words iterate over.
+var iterable = []types.ValueType{types.ValueSlice, types.ValueBlob, types.ValueString, types.ValueMap, types.ValueLines}
+
+// iterArgs pops the quotation and collection for a word of the form
+// ( collection quot -- ... ).
+func iterArgs(e *Env) (Value, Code, error) {
+	code, err := popCode(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	v := e.Stack.Pop()
+	if _, ok := v.(types.Iterable); !ok {
+		return nil, nil, typeError(v, iterable...)
+	}
+	return v, code, nil
+}
+
+// forEach pushes each element of v and calls code, then calls f with the
+// element, until f returns false or an error occurs.
+func forEach(e *Env, v Value, code Code, f func(elem types.Value) (bool, error)) error {
+	var err error
+	v.(types.Iterable).Iter(func(elem types.Value) bool {
+		e.Stack.Push(elem)
+		if err = e.Call(code.Run); err != nil {
+			return false
+		}
+		var more bool
+		more, err = f(elem)
+		return err == nil && more
+	})
+	if err != nil {
+		return err
+	}
+	return iterErr(v)
+}
+
+// iterErr returns the error, if there was one, that ended iterating over v
+// early.
+func iterErr(v Value) error {
+	if lines, ok := v.(*types.LinesValue); ok {
+		return lines.Err
+	}
+	return nil
+}
+
+// popBool pops the result of a predicate quotation.
+func popBool(e *Env) (bool, error) {
+	v := e.Stack.Pop()
+	b, ok := v.(types.BoolValue)
+	if !ok {
+		return false, typeError(v, types.ValueBool)
+	}
+	return b.Val, nil
+}
+
+// collect returns elems, taken from like, as a value of the same type as
+// like.
+func collect(like Value, elems []types.Value) Value {
+	switch like.(type) {
+	case *types.BlobValue:
+		b := make([]byte, len(elems))
+		for i, v := range elems {
+			b[i] = v.(types.ByteValue).Val
+		}
+		return &types.BlobValue{types.ValueBlob, b}
+	case types.StringValue:
+		var b strings.Builder
+		for _, v := range elems {
+			b.WriteString(v.(types.StringValue).Val)
+		}
+		return types.NewString(b.String())
+	case *types.MapValue:
+		m := types.NewMap()
+		for _, v := range elems {
+			entry := v.(*types.SliceValue).Val
+			m.Put(entry[0], entry[1])
+		}
+		return m
+	}
+	return &types.SliceValue{types.ValueSlice, elems}
+}
+
+// each is ( collection quot -- ), calling quot with each element.
+func each(e *Env) error {
+	v, code, err := iterArgs(e)
+	if err != nil {
+		return err
+	}
+	return forEach(e, v, code, func(types.Value) (bool, error) { return true, nil })
+}
+
+// mapElems is map ( collection quot -- slice ), collecting the value quot
+// leaves for each element into a slice.
+func mapElems(e *Env) error {
+	v, code, err := iterArgs(e)
+	if err != nil {
+		return err
+	}
+	var out []types.Value
+	err = forEach(e, v, code, func(types.Value) (bool, error) {
+		out = append(out, e.Stack.Pop())
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	e.Stack.Push(&types.SliceValue{types.ValueSlice, out})
+	return nil
+}
+
+// filter is ( collection quot -- collection ), keeping the elements for
+// which quot leaves true.
+func filter(e *Env) error {
+	v, code, err := iterArgs(e)
+	if err != nil {
+		return err
+	}
+	var kept []types.Value
+	err = forEach(e, v, code, func(elem types.Value) (bool, error) {
+		keep, err := popBool(e)
+		if keep {
+			kept = append(kept, elem)
+		}
+		return true, err
+	})
+	if err != nil {
+		return err
+	}
+	e.Stack.Push(collect(v, kept))
+	return nil
+}
+
+// reduce is ( collection initial quot -- result ), where quot is
+// ( accumulator element -- accumulator ).
+func reduce(e *Env) error {
+	code, err := popCode(e)
+	if err != nil {
+		return err
+	}
+	e.Stack.Swap()
+	v := e.Stack.Pop()
+	if _, ok := v.(types.Iterable); !ok {
+		return typeError(v, iterable...)
+	}
+	return forEach(e, v, code, func(types.Value) (bool, error) { return true, nil })
+}
+
+// search returns a word that calls quot for elements until it leaves want,
+// then calls found with the element and true, or with nil and false if there
+// is none.
+func search(want bool, found func(e *Env, elem types.Value, ok bool)) FuncValue {
+	return func(e *Env) error {
+		v, code, err := iterArgs(e)
+		if err != nil {
+			return err
+		}
+		var match types.Value
+		var ok bool
+		err = forEach(e, v, code, func(elem types.Value) (bool, error) {
+			b, err := popBool(e)
+			if b == want {
+				match, ok = elem, true
+			}
+			return !ok, err
+		})
+		if err != nil {
+			return err
+		}
+		found(e, match, ok)
+		return nil
+	}
+}
+
+// sortBy is sort-by ( collection quot -- collection ), where quot is
+// ( element -- key ). Elements are sorted by their keys, which must be
+// comparable with <, and keep their order when keys are equal.
+func sortBy(e *Env) error {
+	v, code, err := iterArgs(e)
+	if err != nil {
+		return err
+	}
+	var elems, keys []types.Value
+	err = forEach(e, v, code, func(elem types.Value) (bool, error) {
+		elems = append(elems, elem)
+		keys = append(keys, e.Stack.Pop())
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	order := make([]int, len(elems))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		c, _, cerr := compareValues(keys[order[i]], keys[order[j]])
+		if err == nil {
+			err = cerr
+		}
+		return c < 0
+	})
+	if err != nil {
+		return err
+	}
+	sorted := make([]types.Value, len(elems))
+	for i, j := range order {
+		sorted[i] = elems[j]
+	}
+	e.Stack.Push(collect(v, sorted))
+	return nil
+}
+
+// reverse is ( collection -- collection ), the elements in reverse order.
+func reverse(e *Env) error {
+	v := e.Stack.Pop()
+	it, ok := v.(types.Iterable)
+	if !ok {
+		return typeError(v, iterable...)
+	}
+	var elems []types.Value
+	it.Iter(func(elem types.Value) bool {
+		elems = append(elems, elem)
+		return true
+	})
+	if err := iterErr(v); err != nil {
+		return err
+	}
+	for i, j := 0, len(elems)-1; i < j; i, j = i+1, j-1 {
+		elems[i], elems[j] = elems[j], elems[i]
+	}
+	e.Stack.Push(collect(v, elems))
+	return nil
+}
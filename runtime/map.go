@@ -0,0 +1,101 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/bruston/roost/types"
+)
+
+// The map words leave the map on the stack, like insert and #, so that calls
+// can be chained.
+
+// peekMap returns the map on top of the stack.
+func peekMap(e *Env) (*types.MapValue, error) {
+	m, ok := e.Stack.Peek().(*types.MapValue)
+	if !ok {
+		return nil, typeError(e.Stack.Peek(), types.ValueMap)
+	}
+	return m, nil
+}
+
+// popKey pops a key from above a map.
+func popKey(e *Env) (*types.MapValue, Value, error) {
+	k := e.Stack.Pop()
+	m, err := peekMap(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !types.ValidKey(k) {
+		return nil, nil, typeError(k, types.KeyTypes...)
+	}
+	return m, k, nil
+}
+
+// mapGet is get ( map key -- map value ), it is an error if the key is not
+// in the map.
+func mapGet(e *Env) error {
+	m, k, err := popKey(e)
+	if err != nil {
+		return err
+	}
+	v, ok := m.Get(k)
+	if !ok {
+		return &KeyError{Key: fmt.Sprint(k)}
+	}
+	e.Stack.Push(v)
+	return nil
+}
+
+// mapPut is put ( map key value -- map ).
+func mapPut(e *Env) error {
+	v := e.Stack.Pop()
+	m, k, err := popKey(e)
+	if err != nil {
+		return err
+	}
+	m.Put(k, v)
+	return nil
+}
+
+// mapHas is has ( map key -- map bool ).
+func mapHas(e *Env) error {
+	m, k, err := popKey(e)
+	if err != nil {
+		return err
+	}
+	_, ok := m.Get(k)
+	e.Stack.PushBool(ok)
+	return nil
+}
+
+// mapDelete is delete ( map key -- map ), deleting a key that is not in the
+// map does nothing.
+func mapDelete(e *Env) error {
+	m, k, err := popKey(e)
+	if err != nil {
+		return err
+	}
+	m.Delete(k)
+	return nil
+}
+
+// mapKeys is keys ( map -- map slice ), the slice holds the keys in order.
+func mapKeys(e *Env) error {
+	m, err := peekMap(e)
+	if err != nil {
+		return err
+	}
+	e.Stack.Push(&types.SliceValue{types.ValueSlice, append([]types.Value(nil), m.Keys()...)})
+	return nil
+}
+
+// mapValues is values ( map -- map slice ), the slice holds the values in
+// the order of their keys.
+func mapValues(e *Env) error {
+	m, err := peekMap(e)
+	if err != nil {
+		return err
+	}
+	e.Stack.Push(&types.SliceValue{types.ValueSlice, append([]types.Value(nil), m.Values()...)})
+	return nil
+}
@@ -0,0 +1,87 @@
+package runtime
+
+import (
+	"net"
+
+	"github.com/bruston/roost/types"
+)
+
+// netAddr returns the address to dial or listen on, for unix sockets the
+// socket's path under Env.Root.
+func netAddr(e *Env, network, addr string) string {
+	switch network {
+	case "unix", "unixgram", "unixpacket":
+		return e.Path(addr)
+	}
+	return addr
+}
+
+// dial is dial ( protocol address -- pipe 0 | msg 1 ), connecting to an
+// address on a network such as "tcp", "udp" or "unix".
+func dial(e *Env) error {
+	s, err := popStrings(e, 2)
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial(s[0], netAddr(e, s[0], s[1]))
+	if err != nil {
+		pushStatus(e, err)
+		return nil
+	}
+	e.Stack.Push(types.NewPipe(conn))
+	pushStatus(e, nil)
+	return nil
+}
+
+// listen is listen ( protocol address -- listener 0 | msg 1 ), listening on
+// an address on a stream network such as "tcp" or "unix". A tcp address with
+// port 0 listens on a free port, see listener-addr.
+func listen(e *Env) error {
+	s, err := popStrings(e, 2)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen(s[0], netAddr(e, s[0], s[1]))
+	if err != nil {
+		pushStatus(e, err)
+		return nil
+	}
+	e.Stack.Push(types.NewListener(l))
+	pushStatus(e, nil)
+	return nil
+}
+
+func peekListener(e *Env) (*types.ListenerValue, error) {
+	l, ok := e.Stack.Peek().(*types.ListenerValue)
+	if !ok {
+		return nil, typeError(e.Stack.Peek(), types.ValueListener)
+	}
+	return l, nil
+}
+
+// accept is accept ( listener -- listener pipe 0 | listener msg 1 ),
+// waiting for the next connection.
+func accept(e *Env) error {
+	l, err := peekListener(e)
+	if err != nil {
+		return err
+	}
+	conn, err := l.Accept()
+	if err != nil {
+		pushStatus(e, err)
+		return nil
+	}
+	e.Stack.Push(conn)
+	pushStatus(e, nil)
+	return nil
+}
+
+// listenerAddr is listener-addr ( listener -- listener address ).
+func listenerAddr(e *Env) error {
+	l, err := peekListener(e)
+	if err != nil {
+		return err
+	}
+	e.Stack.PushString(l.Val.Addr().String())
+	return nil
+}
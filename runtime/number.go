@@ -0,0 +1,321 @@
+package runtime
+
+import (
+	"math/big"
+
+	"github.com/bruston/roost/types"
+)
+
+// DefaultDivisionScale is the minimum number of decimal places the quotient
+// of two decimals is calculated to.
+const DefaultDivisionScale = 16
+
+// arith is a binary operator defined for whichever of pairs of numbers,
+// bytes, strings and bools it has a function for. Numbers of different types
+// are promoted to a common type first, see promote. Integer arithmetic wraps
+// around on overflow and byte arithmetic modulo 256.
+type arith struct {
+	int  func(a, b int64) int64
+	num  func(a, b float64) float64
+	big  func(a, b *big.Int) *big.Int
+	dec  func(e *Env, a, b types.DecimalValue) types.DecimalValue
+	byte func(a, b byte) byte
+	str  func(a, b string) string
+	bool func(a, b bool) bool
+	div  bool // whether a zero right operand is an error
+}
+
+func (op arith) numeric() []types.ValueType {
+	var t []types.ValueType
+	if op.int != nil {
+		t = append(t, types.ValueInt)
+	}
+	if op.num != nil {
+		t = append(t, types.ValueNum)
+	}
+	if op.big != nil {
+		t = append(t, types.ValueBigInt)
+	}
+	if op.dec != nil {
+		t = append(t, types.ValueDecimal)
+	}
+	return t
+}
+
+func (op arith) expected() []types.ValueType {
+	t := op.numeric()
+	if op.byte != nil {
+		t = append(t, types.ValueByte)
+	}
+	if op.str != nil {
+		t = append(t, types.ValueString)
+	}
+	if op.bool != nil {
+		t = append(t, types.ValueBool)
+	}
+	return t
+}
+
+// word pops two operands, applies the operator and pushes the result.
+func (op arith) word(e *Env) error {
+	n2, n1 := e.Stack.Pop(), e.Stack.Pop()
+	switch a := n1.(type) {
+	case types.Number:
+		b, ok := n2.(types.Number)
+		if !ok {
+			return typeError(n2, op.numeric()...)
+		}
+		return op.number(e, a, b)
+	case types.ByteValue:
+		if op.byte == nil {
+			break
+		}
+		b, ok := n2.(types.ByteValue)
+		if !ok {
+			return typeError(n2, types.ValueByte)
+		}
+		if op.div && b.Val == 0 {
+			return ErrDivisionByZero
+		}
+		e.Stack.PushByte(op.byte(a.Val, b.Val))
+		return nil
+	case types.StringValue:
+		if op.str == nil {
+			break
+		}
+		b, ok := n2.(types.StringValue)
+		if !ok {
+			return typeError(n2, types.ValueString)
+		}
+		e.Stack.PushString(op.str(a.Val, b.Val))
+		return nil
+	case types.BoolValue:
+		if op.bool == nil {
+			break
+		}
+		b, ok := n2.(types.BoolValue)
+		if !ok {
+			return typeError(n2, types.ValueBool)
+		}
+		e.Stack.PushBool(op.bool(a.Val, b.Val))
+		return nil
+	}
+	return typeError(n1, op.expected()...)
+}
+
+// number applies the operator to two numbers promoted to a common type.
+func (op arith) number(e *Env, a, b types.Number) error {
+	kind, err := promote(a, b)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case types.ValueInt:
+		if op.int == nil {
+			break
+		}
+		x, y := a.(types.IntValue).Val, b.(types.IntValue).Val
+		if op.div && y == 0 {
+			return ErrDivisionByZero
+		}
+		e.Stack.PushInt(op.int(x, y))
+		return nil
+	case types.ValueNum:
+		if op.num == nil {
+			break
+		}
+		if op.div && b.Float() == 0 {
+			return ErrDivisionByZero
+		}
+		e.Stack.PushNum(op.num(a.Float(), b.Float()))
+		return nil
+	case types.ValueBigInt:
+		if op.big == nil {
+			break
+		}
+		x, y := toBigInt(a), toBigInt(b)
+		if op.div && y.Sign() == 0 {
+			return ErrDivisionByZero
+		}
+		e.Stack.Push(types.NewBigInt(op.big(x, y)))
+		return nil
+	case types.ValueDecimal:
+		if op.dec == nil {
+			break
+		}
+		x, y := toDecimal(a), toDecimal(b)
+		if op.div && y.Unscaled.Sign() == 0 {
+			return ErrDivisionByZero
+		}
+		e.Stack.Push(op.dec(e, x, y))
+		return nil
+	}
+	// the operator isn't defined for the promoted type, blame whichever
+	// operand has it
+	if a.Type() == kind {
+		return typeError(a, op.numeric()...)
+	}
+	return typeError(b, op.numeric()...)
+}
+
+// rank orders the exact numeric types by which can represent the others.
+var rank = map[types.ValueType]int{
+	types.ValueInt:     0,
+	types.ValueBigInt:  1,
+	types.ValueDecimal: 2,
+}
+
+// promote returns the type two numbers are converted to before an operation.
+// Integers, big integers and decimals promote to the widest of the two.
+// Integers and floats promote to floats, but a big integer or decimal mixed
+// with a float is a type error rather than silently losing precision.
+func promote(a, b types.Number) (types.ValueType, error) {
+	at, bt := a.Type(), b.Type()
+	if at == types.ValueNum || bt == types.ValueNum {
+		if at == types.ValueBigInt || at == types.ValueDecimal {
+			return 0, typeError(b, types.ValueInt, types.ValueBigInt, types.ValueDecimal)
+		}
+		if bt == types.ValueBigInt || bt == types.ValueDecimal {
+			return 0, typeError(a, types.ValueInt, types.ValueBigInt, types.ValueDecimal)
+		}
+		return types.ValueNum, nil
+	}
+	if rank[at] > rank[bt] {
+		return at, nil
+	}
+	return bt, nil
+}
+
+func toBigInt(n types.Number) *big.Int {
+	switch v := n.(type) {
+	case types.IntValue:
+		return big.NewInt(v.Val)
+	case types.BigIntValue:
+		return v.Val
+	}
+	return nil
+}
+
+func toDecimal(n types.Number) types.DecimalValue {
+	if v, ok := n.(types.DecimalValue); ok {
+		return v
+	}
+	return types.DecimalFromInt(toBigInt(n))
+}
+
+// MaxBigIntShift is the largest count a big integer may be shifted left by,
+// so a script can't make a big integer too large to hold in memory.
+const MaxBigIntShift = 1 << 20
+
+// shift returns a word shifting an integer, big integer or byte left or right
+// by a non-negative integer count.
+func shift(left bool) FuncValue {
+	return func(e *Env) error {
+		v2, v1 := e.Stack.Pop(), e.Stack.Pop()
+		n, ok := v2.(types.IntValue)
+		if !ok {
+			return typeError(v2, types.ValueInt)
+		}
+		if n.Val < 0 {
+			return ErrNegativeShift
+		}
+		switch v := v1.(type) {
+		case types.IntValue:
+			if left {
+				e.Stack.PushInt(v.Val << uint64(n.Val))
+			} else {
+				e.Stack.PushInt(v.Val >> uint64(n.Val))
+			}
+		case types.BigIntValue:
+			if left {
+				if n.Val > MaxBigIntShift {
+					return ErrShiftTooLarge
+				}
+				e.Stack.Push(types.NewBigInt(new(big.Int).Lsh(v.Val, uint(n.Val))))
+			} else {
+				e.Stack.Push(types.NewBigInt(new(big.Int).Rsh(v.Val, uint(n.Val))))
+			}
+		case types.ByteValue:
+			if left {
+				e.Stack.PushByte(v.Val << uint64(n.Val))
+			} else {
+				e.Stack.PushByte(v.Val >> uint64(n.Val))
+			}
+		default:
+			return typeError(v1, types.ValueInt, types.ValueBigInt, types.ValueByte)
+		}
+		return nil
+	}
+}
+
+// compare pops two values and returns -1, 0 or 1 as the first pushed is less
+// than, equal to or greater than the second, see types.Compare. ordered is
+// false if either is NaN.
+func compare(e *Env) (c int, ordered bool, err error) {
+	n2, n1 := e.Stack.Pop(), e.Stack.Pop()
+	return compareValues(n1, n2)
+}
+
+// comparison returns a word comparing two values, pushing whether test is
+// true of their order. Comparisons with NaN are always false.
+func comparison(test func(c int) bool) FuncValue {
+	return func(e *Env) error {
+		c, ordered, err := compare(e)
+		if err != nil {
+			return err
+		}
+		e.Stack.PushBool(ordered && test(c))
+		return nil
+	}
+}
+
+// compareValues is compare for values already popped.
+func compareValues(n1, n2 Value) (c int, ordered bool, err error) {
+	if c, ordered = types.Compare(n1, n2); ordered {
+		return c, true, nil
+	}
+	return 0, false, orderError(n1, n2)
+}
+
+// orderError returns why a and b can't be ordered: a type error for the first
+// pair of values, themselves or elements of them, that can't be compared. It
+// is nil if a NaN is to blame, comparisons with NaN are false not errors.
+func orderError(a, b Value) error {
+	if !types.Ordered(types.TypeOf(a)) {
+		return typeError(a, types.ValueInt, types.ValueNum, types.ValueBigInt, types.ValueDecimal,
+			types.ValueByte, types.ValueString, types.ValueBool, types.ValueSlice, types.ValueBlob)
+	}
+	if _, ok := a.(types.Number); ok {
+		if _, ok := b.(types.Number); !ok {
+			return typeError(b, types.ValueInt, types.ValueNum, types.ValueBigInt, types.ValueDecimal)
+		}
+		return nil
+	}
+	if a.Type() != types.TypeOf(b) {
+		return typeError(b, a.Type())
+	}
+	if x, ok := a.(*types.SliceValue); ok {
+		y := b.(*types.SliceValue)
+		for i := 0; i < len(x.Val) && i < len(y.Val); i++ {
+			if _, ordered := types.Compare(x.Val[i], y.Val[i]); !ordered {
+				return orderError(x.Val[i], y.Val[i])
+			}
+		}
+	}
+	return nil
+}
+
+// divideDecimals is the decimal quotient: calculated to Env.DivisionScale
+// places, or more if either operand has more, rounded using Env.Rounding then
+// trimmed of trailing zeros beyond the larger scale of the operands.
+func divideDecimals(e *Env, a, b types.DecimalValue) types.DecimalValue {
+	scale := a.Scale
+	if b.Scale > scale {
+		scale = b.Scale
+	}
+	places := scale
+	if e.DivisionScale > places {
+		places = e.DivisionScale
+	}
+	return a.Quo(b, places, e.Rounding).Trim(scale)
+}
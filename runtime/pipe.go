@@ -0,0 +1,166 @@
+package runtime
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/bruston/roost/types"
+)
+
+// The pipe words push a status code after any results: StatusOK with the
+// results below it, StatusError with an error message below it, or StatusEOF
+// when a read finds nothing left to read.
+const (
+	StatusOK    = 0
+	StatusError = 1
+	StatusEOF   = -1
+)
+
+// pushStatus pushes the status code for err, and the error message if it is
+// not nil or io.EOF.
+func pushStatus(e *Env, err error) {
+	switch err {
+	case nil:
+		e.Stack.PushInt(StatusOK)
+	case io.EOF:
+		e.Stack.PushInt(StatusEOF)
+	default:
+		e.Stack.PushString(err.Error())
+		e.Stack.PushInt(StatusError)
+	}
+}
+
+func peekPipe(e *Env) (*types.PipeValue, error) {
+	p, ok := e.Stack.Peek().(*types.PipeValue)
+	if !ok {
+		return nil, typeError(e.Stack.Peek(), types.ValuePipe)
+	}
+	return p, nil
+}
+
+// popCount pops a non-negative number of bytes to read from above a pipe.
+func popCount(e *Env) (*types.PipeValue, int, error) {
+	n, err := popInt(e)
+	if err != nil {
+		return nil, 0, err
+	}
+	p, err := peekPipe(e)
+	if err != nil {
+		return nil, 0, err
+	}
+	if n < 0 {
+		return nil, 0, &IndexError{Index: int(n), Len: 0}
+	}
+	return p, int(n), nil
+}
+
+// send is send ( pipe data -- pipe n 0 | pipe msg 1 ), writing a string or
+// blob and pushing the number of bytes written.
+func send(e *Env) error {
+	payload := e.Stack.Pop()
+	if t := types.TypeOf(payload); t != types.ValueString && t != types.ValueBlob {
+		return typeError(payload, types.ValueString, types.ValueBlob)
+	}
+	p, err := peekPipe(e)
+	if err != nil {
+		return err
+	}
+	n, err := p.Write(payload)
+	if err != nil {
+		pushStatus(e, err)
+		return nil
+	}
+	e.Stack.PushInt(int64(n))
+	pushStatus(e, nil)
+	return nil
+}
+
+// closeValue is close ( pipe -- 0 | msg 1 ), or ( listener -- 0 | msg 1 ).
+func closeValue(e *Env) error {
+	var err error
+	switch v := e.Stack.Peek().(type) {
+	case *types.PipeValue:
+		err = v.Close()
+	case *types.ListenerValue:
+		err = v.Close()
+	default:
+		return typeError(v, types.ValuePipe, types.ValueListener)
+	}
+	e.Stack.Drop()
+	pushStatus(e, err)
+	return nil
+}
+
+// maxRecv is the most recv reads at once, whatever count it is given.
+const maxRecv = 64 * 1024
+
+// recv is recv ( pipe n -- pipe blob 0 | pipe -1 | pipe msg 1 ), reading
+// whatever is available, up to n bytes or maxRecv.
+func recv(e *Env) error {
+	p, n, err := popCount(e)
+	if err != nil {
+		return err
+	}
+	if n > maxRecv {
+		n = maxRecv
+	}
+	b := make([]byte, n)
+	n, err = p.Read(b)
+	if n > 0 {
+		err = nil
+	}
+	pushBlob(e, b[:n], err)
+	return nil
+}
+
+// readN is read-n ( pipe n -- pipe blob 0 | pipe -1 | pipe msg 1 ), reading
+// n bytes, or fewer if the pipe ends first. The blob grows as bytes arrive
+// rather than being made n bytes long up front.
+func readN(e *Env) error {
+	p, n, err := popCount(e)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	_, err = b.ReadFrom(io.LimitReader(p, int64(n)))
+	if err == nil && b.Len() == 0 && n > 0 {
+		err = io.EOF
+	}
+	pushBlob(e, b.Bytes(), err)
+	return nil
+}
+
+// readAll is read-all ( pipe -- pipe blob 0 | pipe msg 1 ), reading until
+// the pipe ends.
+func readAll(e *Env) error {
+	p, err := peekPipe(e)
+	if err != nil {
+		return err
+	}
+	b, err := io.ReadAll(p)
+	pushBlob(e, b, err)
+	return nil
+}
+
+// readLine is read-line ( pipe -- pipe string 0 | pipe -1 | pipe msg 1 ),
+// reading the next line without its line ending.
+func readLine(e *Env) error {
+	p, err := peekPipe(e)
+	if err != nil {
+		return err
+	}
+	line, err := p.ReadLine()
+	if err == nil {
+		e.Stack.PushString(line)
+	}
+	pushStatus(e, err)
+	return nil
+}
+
+// pushBlob pushes the result of a read.
+func pushBlob(e *Env, b []byte, err error) {
+	if err == nil {
+		e.Stack.PushBlob(b)
+	}
+	pushStatus(e, err)
+}
@@ -1,7 +1,7 @@
 package runtime
 
 import (
-	"errors"
+	"fmt"
 	"io"
 	"os"
 
@@ -13,69 +13,253 @@ type Value interface {
 	Value() interface{}
 }
 
+// DefaultStackLimit is the stack limit used by the roost command.
+const DefaultStackLimit = 1 << 16
+
+// Stack is a stack of values that grows as values are pushed. Pushing more
+// than Limit values fails with a *StackOverflowError, a Limit of zero means
+// the stack may grow until memory runs out.
 type Stack struct {
-	data []Value
-	top  int
+	data  []Value
+	Limit int
 }
 
+// Push, Pop and the other stack operations panic with a *StackOverflowError
+// or *StackUnderflowError, the evaluator recovers these and returns them from
+// Eval.
 func (s *Stack) Push(v Value) {
-	s.top++
-	s.data[s.top] = v
+	s.room(1)
+	s.data = append(s.data, v)
 }
 
 func (s *Stack) Pop() Value {
-	v := s.data[s.top]
-	s.data[s.top] = nil
-	s.top--
+	s.need(1)
+	top := len(s.data) - 1
+	v := s.data[top]
+	s.data[top] = nil
+	s.data = s.data[:top]
 	return v
 }
 
-func (s *Stack) Peek() Value { return s.data[s.top] }
+func (s *Stack) Peek() Value {
+	s.need(1)
+	return s.data[len(s.data)-1]
+}
+
+// At returns the value n below the top of the stack without removing it, 0
+// is the top of the stack. n must not be negative.
+func (s *Stack) At(n int) Value { return s.top(n + 1)[0] }
 
-func (s *Stack) Dup() { s.Push(s.data[s.top]) }
+// The remaining operations are named after their Forth equivalents and are
+// documented with Forth stack comments, the top of the stack is on the right.
+// They check the stack before modifying it, so a failed operation leaves the
+// stack unchanged.
 
+// Dup is ( a -- a a ).
+func (s *Stack) Dup() { s.Push(s.Peek()) }
+
+// Drop is ( a -- ).
 func (s *Stack) Drop() { s.Pop() }
 
+// Swap is ( a b -- b a ).
 func (s *Stack) Swap() {
-	s.data[s.top], s.data[s.top-1] = s.data[s.top-1], s.data[s.top]
+	d := s.top(2)
+	d[0], d[1] = d[1], d[0]
+}
+
+// Over is ( a b -- a b a ).
+func (s *Stack) Over() { s.Pick(1) }
+
+// Rot is ( a b c -- b c a ).
+func (s *Stack) Rot() { s.Roll(2) }
+
+// RotBack is -rot ( a b c -- c a b ).
+func (s *Stack) RotBack() {
+	d := s.top(3)
+	d[0], d[1], d[2] = d[2], d[0], d[1]
+}
+
+// Nip is ( a b -- b ).
+func (s *Stack) Nip() {
+	d := s.top(2)
+	d[0] = d[1]
+	s.Pop()
+}
+
+// Tuck is ( a b -- b a b ).
+func (s *Stack) Tuck() {
+	s.need(2)
+	s.Push(s.Peek())
+	d := s.top(3)
+	d[0], d[1] = d[2], d[0]
+}
+
+// Pick copies the value n below the top of the stack to the top,
+// ( xn ... x0 -- xn ... x0 xn ). 0 pick is dup and 1 pick is over. n must
+// not be negative.
+func (s *Stack) Pick(n int) { s.Push(s.At(n)) }
+
+// Roll moves the value n below the top of the stack to the top,
+// ( xn ... x0 -- xn-1 ... x0 xn ). 1 roll is swap and 2 roll is rot. n must
+// not be negative.
+func (s *Stack) Roll(n int) {
+	d := s.top(n + 1)
+	v := d[0]
+	copy(d, d[1:])
+	d[n] = v
+}
+
+// TwoDup is ( a b -- a b a b ).
+func (s *Stack) TwoDup() { s.twoPick(1) }
+
+// TwoDrop is ( a b -- ).
+func (s *Stack) TwoDrop() {
+	s.need(2)
+	s.Pop()
+	s.Pop()
+}
+
+// TwoSwap is ( a b c d -- c d a b ).
+func (s *Stack) TwoSwap() {
+	d := s.top(4)
+	d[0], d[1], d[2], d[3] = d[2], d[3], d[0], d[1]
+}
+
+// TwoOver is ( a b c d -- a b c d a b ).
+func (s *Stack) TwoOver() { s.twoPick(3) }
+
+// twoPick copies the pair whose lower value is n below the top of the stack.
+func (s *Stack) twoPick(n int) {
+	d := s.top(n + 1)
+	s.room(2)
+	s.data = append(s.data, d[0], d[1])
+}
+
+// Clear removes every value from the stack.
+func (s *Stack) Clear() {
+	for i := range s.data {
+		s.data[i] = nil
+	}
+	s.data = s.data[:0]
+}
+
+// top returns the top n values of the stack, the top of the stack last.
+func (s *Stack) top(n int) []Value {
+	s.need(n)
+	return s.data[len(s.data)-n:]
+}
+
+func (s *Stack) need(n int) {
+	if len(s.data) < n {
+		panic(&StackUnderflowError{})
+	}
+}
+
+func (s *Stack) room(n int) {
+	if s.Limit > 0 && len(s.data)+n > s.Limit {
+		panic(&StackOverflowError{Depth: len(s.data)})
+	}
 }
 
 func (s *Stack) PushBool(b bool) { s.Push(types.BoolValue{types.ValueBool, b}) }
 
 func (s *Stack) PushNum(n float64) { s.Push(types.NewNum(n)) }
 
+func (s *Stack) PushInt(n int64) { s.Push(types.NewInt(n)) }
+
 func (s *Stack) PushString(str string) { s.Push(types.NewString(str)) }
 
+func (s *Stack) PushByte(b byte) { s.Push(types.NewByte(b)) }
+
 func (s *Stack) PushBlob(b []byte) { s.Push(&types.BlobValue{types.ValueBlob, b}) }
 
-func (s *Stack) Len() int { return s.top + 1 }
+func (s *Stack) Len() int { return len(s.data) }
 
-func NewStack(size int) *Stack { return &Stack{data: make([]Value, size), top: -1} }
+// NewStack returns an empty stack that holds at most limit values, or any
+// number of values if limit is zero.
+func NewStack(limit int) *Stack { return &Stack{Limit: limit} }
 
-var ErrStackError = errors.New("stack under/overflow")
+// FuncValue is a word implemented in Go.
+type FuncValue func(*Env) error
 
-type FuncValue func(*Env)
+// TailCall is returned by a FuncValue, in place of an error, to have Word
+// called after it has returned. Making its last call this way keeps the Go
+// stack from growing, so words may recurse in tail position indefinitely.
+type TailCall struct{ Word FuncValue }
 
+func (tc *TailCall) Error() string { return "unhandled tail call" }
+
+// Call calls word with e followed by any tail calls it returns. The words in
+// Builtin and Words must be called through Call.
+func (e *Env) Call(word FuncValue) error {
+	for {
+		err := word(e)
+		tc, ok := err.(*TailCall)
+		if !ok {
+			return err
+		}
+		word = tc.Word
+	}
+}
+
+// Code is implemented by the Code of quotations the evaluator creates.
+type Code interface {
+	fmt.Stringer
+	Run(*Env) error
+}
+
+// CallQuotation pops a quotation and calls it.
+func (e *Env) CallQuotation() error {
+	code, err := popCode(e)
+	if err != nil {
+		return err
+	}
+	return e.Call(code.Run)
+}
+
+// DefaultMaxCallDepth is the MaxCallDepth of a new Env.
+const DefaultMaxCallDepth = 100000
+
+// Env is the state a program runs in. Rounding and DivisionScale control
+// how decimals are divided, see DefaultDivisionScale. CallDepth counts the
+// words defined by the program that are running, calling a word when there
+// are already MaxCallDepth running fails with a *StackOverflowError, zero
+// means no limit. Root, if not empty, is the directory the file words work
+// in, see Env.Path. Stdin should be set before a script first reads from it.
 type Env struct {
-	Stack   *Stack
-	Return  *Stack
-	Stdin   io.Reader
-	Stdout  io.Writer
-	Stderr  io.Writer
-	Builtin map[string]FuncValue
-	Vars    map[string]Value
-	Words   map[string]FuncValue
+	Stack         *Stack
+	Return        *Stack
+	Stdin         io.Reader
+	Stdout        io.Writer
+	Stderr        io.Writer
+	Builtin       map[string]FuncValue
+	Vars          map[string]Value
+	Words         map[string]FuncValue
+	Rounding      types.RoundingMode
+	DivisionScale int
+	CallDepth     int
+	MaxCallDepth  int
+	Root          string
+
+	stdin *types.PipeValue
 }
 
-func New(stackSize int) *Env {
+// New returns an Env whose data and return stacks each hold at most
+// stackLimit values, or grow without bound if stackLimit is zero. The limits
+// may be changed independently through the Limit field of each stack.
+func New(stackLimit int) *Env {
 	return &Env{
-		Stack:   NewStack(stackSize),
-		Return:  NewStack(stackSize),
+		Stack:   NewStack(stackLimit),
+		Return:  NewStack(stackLimit),
 		Stdin:   os.Stdin,
 		Stdout:  os.Stdout,
 		Stderr:  os.Stderr,
 		Builtin: Builtin,
 		Vars:    make(map[string]Value),
 		Words:   make(map[string]FuncValue),
+
+		Rounding:      types.HalfEven,
+		DivisionScale: DefaultDivisionScale,
+		MaxCallDepth:  DefaultMaxCallDepth,
 	}
 }
@@ -0,0 +1,61 @@
+package runtime
+
+import (
+	"errors"
+	"io"
+
+	"github.com/bruston/roost/types"
+)
+
+var errStdinWrite = errors.New("cannot write to stdin")
+
+// stdinReader lets Env.Stdin be used as a pipe. Writing to it fails and
+// closing it does nothing, so a script can't close the process's stdin.
+type stdinReader struct{ io.Reader }
+
+func (stdinReader) Write(b []byte) (int, error) { return 0, errStdinWrite }
+
+func (stdinReader) Close() error { return nil }
+
+// stdinPipe returns the pipe reading Env.Stdin. It is created on first use
+// and shared by all the words reading stdin so they share its buffer.
+func stdinPipe(e *Env) *types.PipeValue {
+	if e.stdin == nil {
+		e.stdin = types.NewPipe(stdinReader{e.Stdin})
+	}
+	return e.stdin
+}
+
+// stdin is stdin ( -- pipe ).
+func stdin(e *Env) error {
+	e.Stack.Push(stdinPipe(e))
+	return nil
+}
+
+// key is key ( -- byte 0 | -1 | msg 1 ), reading a byte from stdin.
+func key(e *Env) error {
+	b, err := stdinPipe(e).ReadByte()
+	if err == nil {
+		e.Stack.PushByte(b)
+	}
+	pushStatus(e, err)
+	return nil
+}
+
+// readStdinLine is read-stdin-line ( -- string 0 | -1 | msg 1 ), see
+// read-line.
+func readStdinLine(e *Env) error {
+	line, err := stdinPipe(e).ReadLine()
+	if err == nil {
+		e.Stack.PushString(line)
+	}
+	pushStatus(e, err)
+	return nil
+}
+
+// stdinLines is stdin-lines ( -- lines ), the lines of stdin for the
+// collection words.
+func stdinLines(e *Env) error {
+	e.Stack.Push(types.NewLines(stdinPipe(e)))
+	return nil
+}
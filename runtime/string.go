@@ -0,0 +1,176 @@
+package runtime
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bruston/roost/types"
+)
+
+// popString pops a string.
+func popString(e *Env) (string, error) {
+	v := e.Stack.Pop()
+	s, ok := v.(types.StringValue)
+	if !ok {
+		return "", typeError(v, types.ValueString)
+	}
+	return s.Val, nil
+}
+
+// popInt pops an integer.
+func popInt(e *Env) (int64, error) {
+	v := e.Stack.Pop()
+	n, ok := v.(types.IntValue)
+	if !ok {
+		return 0, typeError(v, types.ValueInt)
+	}
+	return n.Val, nil
+}
+
+// popStrings pops n strings, returning them in the order they were pushed.
+func popStrings(e *Env, n int) ([]string, error) {
+	s := make([]string, n)
+	for i := n - 1; i >= 0; i-- {
+		var err error
+		if s[i], err = popString(e); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// stringFunc returns a word replacing the string on top of the stack with
+// f of it.
+func stringFunc(f func(string) string) FuncValue {
+	return func(e *Env) error {
+		s, err := popString(e)
+		if err != nil {
+			return err
+		}
+		e.Stack.PushString(f(s))
+		return nil
+	}
+}
+
+// stringTest returns a word ( s t -- bool ) pushing f(s, t).
+func stringTest(f func(s, t string) bool) FuncValue {
+	return func(e *Env) error {
+		s, err := popStrings(e, 2)
+		if err != nil {
+			return err
+		}
+		e.Stack.PushBool(f(s[0], s[1]))
+		return nil
+	}
+}
+
+// substring is ( s start end -- s ), the characters from start up to but not
+// including end.
+func substring(e *Env) error {
+	end, err := popInt(e)
+	if err != nil {
+		return err
+	}
+	start, err := popInt(e)
+	if err != nil {
+		return err
+	}
+	v := e.Stack.Pop()
+	s, ok := v.(types.StringValue)
+	if !ok {
+		return typeError(v, types.ValueString)
+	}
+	r := &types.SliceValue{types.ValueSlice, []types.Value{types.NewInt(start), types.NewInt(end)}}
+	if err := checkIndex(r, s.Len()); err != nil {
+		return err
+	}
+	e.Stack.Push(s.Index(r))
+	return nil
+}
+
+// indexOf is index-of ( s sub -- n ), the character index of the first sub
+// in s or -1 if there is none.
+func indexOf(e *Env) error {
+	s, err := popStrings(e, 2)
+	if err != nil {
+		return err
+	}
+	i := strings.Index(s[0], s[1])
+	if i > 0 {
+		i = utf8.RuneCountInString(s[0][:i])
+	}
+	e.Stack.PushInt(int64(i))
+	return nil
+}
+
+// split is ( s sep -- slice ), the strings between each sep. An empty sep
+// splits s into characters.
+func split(e *Env) error {
+	s, err := popStrings(e, 2)
+	if err != nil {
+		return err
+	}
+	parts := strings.Split(s[0], s[1])
+	elems := make([]types.Value, len(parts))
+	for i, p := range parts {
+		elems[i] = types.NewString(p)
+	}
+	e.Stack.Push(&types.SliceValue{types.ValueSlice, elems})
+	return nil
+}
+
+// join is ( slice sep -- s ), the strings in slice with sep between them.
+func join(e *Env) error {
+	sep, err := popString(e)
+	if err != nil {
+		return err
+	}
+	v := e.Stack.Pop()
+	slice, ok := v.(*types.SliceValue)
+	if !ok {
+		return typeError(v, types.ValueSlice)
+	}
+	parts := make([]string, len(slice.Val))
+	for i, elem := range slice.Val {
+		s, ok := elem.(types.StringValue)
+		if !ok {
+			return typeError(elem, types.ValueString)
+		}
+		parts[i] = s.Val
+	}
+	e.Stack.PushString(strings.Join(parts, sep))
+	return nil
+}
+
+// replace is ( s old new -- s ), replacing every old in s with new.
+func replace(e *Env) error {
+	s, err := popStrings(e, 3)
+	if err != nil {
+		return err
+	}
+	e.Stack.PushString(strings.ReplaceAll(s[0], s[1], s[2]))
+	return nil
+}
+
+// MaxReplicateLen is the longest string, in bytes, replicate may make.
+const MaxReplicateLen = 1 << 26
+
+// replicate is ( s n -- s ), s repeated n times.
+func replicate(e *Env) error {
+	n, err := popInt(e)
+	if err != nil {
+		return err
+	}
+	s, err := popString(e)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return &IndexError{Index: int(n), Len: 0}
+	}
+	if len(s) > 0 && n > MaxReplicateLen/int64(len(s)) {
+		return ErrStringTooLong
+	}
+	e.Stack.PushString(strings.Repeat(s, int(n)))
+	return nil
+}
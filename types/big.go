@@ -0,0 +1,252 @@
+package types
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// BigIntValue is an arbitrary precision integer. Its Val must not be modified
+// once the value has been created.
+type BigIntValue struct {
+	ValueType
+	Val *big.Int
+}
+
+func (bv BigIntValue) Value() interface{} { return bv.Val }
+
+func (bv BigIntValue) String() string { return bv.Val.String() }
+
+func (bv BigIntValue) Float() float64 {
+	f, _ := new(big.Float).SetInt(bv.Val).Float64()
+	return f
+}
+
+func NewBigInt(n *big.Int) BigIntValue { return BigIntValue{ValueBigInt, n} }
+
+// RoundingMode determines how a decimal is rounded when it has more digits
+// than fit in the scale it is being rounded to.
+type RoundingMode int
+
+const (
+	HalfEven RoundingMode = iota // to nearest, ties to the even neighbour
+	HalfUp                       // to nearest, ties away from zero
+	HalfDown                     // to nearest, ties towards zero
+	Up                           // away from zero
+	Down                         // towards zero
+	Ceiling                      // towards positive infinity
+	Floor                        // towards negative infinity
+)
+
+var roundingNames = [...]string{
+	HalfEven: "half-even",
+	HalfUp:   "half-up",
+	HalfDown: "half-down",
+	Up:       "up",
+	Down:     "down",
+	Ceiling:  "ceiling",
+	Floor:    "floor",
+}
+
+func (m RoundingMode) String() string { return roundingNames[m] }
+
+// ParseRoundingMode returns the rounding mode with the given name, as
+// returned by String.
+func ParseRoundingMode(name string) (RoundingMode, bool) {
+	for m, n := range roundingNames {
+		if n == name {
+			return RoundingMode(m), true
+		}
+	}
+	return 0, false
+}
+
+// DecimalValue is an exact decimal number equal to Unscaled × 10^-Scale,
+// Scale is never negative. Operations return new values and never modify
+// their operands.
+type DecimalValue struct {
+	ValueType
+	Unscaled *big.Int
+	Scale    int
+}
+
+// Value returns the decimal as a *big.Rat.
+func (dv DecimalValue) Value() interface{} { return dv.Rat() }
+
+func (dv DecimalValue) Rat() *big.Rat { return new(big.Rat).SetFrac(dv.Unscaled, pow10(dv.Scale)) }
+
+func (dv DecimalValue) Float() float64 {
+	f, _ := dv.Rat().Float64()
+	return f
+}
+
+func (dv DecimalValue) String() string {
+	digits := new(big.Int).Abs(dv.Unscaled).String()
+	if dv.Scale > 0 {
+		if len(digits) <= dv.Scale {
+			digits = strings.Repeat("0", dv.Scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-dv.Scale] + "." + digits[len(digits)-dv.Scale:]
+	}
+	if dv.Unscaled.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+func NewDecimal(unscaled *big.Int, scale int) DecimalValue {
+	return DecimalValue{ValueDecimal, unscaled, scale}
+}
+
+// DecimalFromInt returns n as a decimal with a scale of zero.
+func DecimalFromInt(n *big.Int) DecimalValue { return NewDecimal(n, 0) }
+
+var errDecimalSyntax = errors.New("invalid decimal syntax")
+
+// MaxDecimalPlaces is the largest exponent a decimal may be written with and
+// the most places one may be rounded to, so a script can't make a decimal too
+// large to hold in memory.
+const MaxDecimalPlaces = 1 << 20
+
+// ParseDecimal parses a decimal written as digits with an optional sign,
+// fraction and exponent, such as -12.50 or 1.5e3. Underscores are ignored.
+func ParseDecimal(s string) (DecimalValue, error) {
+	s = strings.ReplaceAll(s, "_", "")
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, ok := new(big.Int).SetString(s[i+1:], 10)
+		if !ok || !e.IsInt64() || e.Int64() > MaxDecimalPlaces || e.Int64() < -MaxDecimalPlaces {
+			return DecimalValue{}, errDecimalSyntax
+		}
+		exp = int(e.Int64())
+		s = s[:i]
+	}
+	var neg bool
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	digits := whole + frac
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return DecimalValue{}, errDecimalSyntax
+	}
+	unscaled, _ := new(big.Int).SetString(digits, 10)
+	if neg {
+		unscaled.Neg(unscaled)
+	}
+	scale := len(frac) - exp
+	if scale < 0 {
+		unscaled.Mul(unscaled, pow10(-scale))
+		scale = 0
+	}
+	return NewDecimal(unscaled, scale), nil
+}
+
+func pow10(n int) *big.Int { return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil) }
+
+// align returns the unscaled values of a and b at their larger scale.
+func align(a, b DecimalValue) (*big.Int, *big.Int, int) {
+	switch {
+	case a.Scale < b.Scale:
+		return new(big.Int).Mul(a.Unscaled, pow10(b.Scale-a.Scale)), b.Unscaled, b.Scale
+	case a.Scale > b.Scale:
+		return a.Unscaled, new(big.Int).Mul(b.Unscaled, pow10(a.Scale-b.Scale)), a.Scale
+	}
+	return a.Unscaled, b.Unscaled, a.Scale
+}
+
+// Add returns a + b with the larger of their scales.
+func (dv DecimalValue) Add(b DecimalValue) DecimalValue {
+	x, y, scale := align(dv, b)
+	return NewDecimal(new(big.Int).Add(x, y), scale)
+}
+
+// Sub returns a - b with the larger of their scales.
+func (dv DecimalValue) Sub(b DecimalValue) DecimalValue {
+	x, y, scale := align(dv, b)
+	return NewDecimal(new(big.Int).Sub(x, y), scale)
+}
+
+// Mul returns a × b with the sum of their scales.
+func (dv DecimalValue) Mul(b DecimalValue) DecimalValue {
+	return NewDecimal(new(big.Int).Mul(dv.Unscaled, b.Unscaled), dv.Scale+b.Scale)
+}
+
+// Quo returns a ÷ b rounded to scale using mode. b must not be zero.
+func (dv DecimalValue) Quo(b DecimalValue, scale int, mode RoundingMode) DecimalValue {
+	num := new(big.Int).Mul(dv.Unscaled, pow10(b.Scale+scale))
+	den := new(big.Int).Mul(b.Unscaled, pow10(dv.Scale))
+	return NewDecimal(quoRound(num, den, mode), scale)
+}
+
+// Rem returns the remainder of a ÷ b truncated towards zero, with the larger
+// of their scales. b must not be zero.
+func (dv DecimalValue) Rem(b DecimalValue) DecimalValue {
+	x, y, scale := align(dv, b)
+	return NewDecimal(new(big.Int).Rem(x, y), scale)
+}
+
+// Cmp returns -1, 0 or 1 as a is less than, equal to or greater than b.
+func (dv DecimalValue) Cmp(b DecimalValue) int {
+	x, y, _ := align(dv, b)
+	return x.Cmp(y)
+}
+
+// Round returns the decimal with the given scale, rounding using mode if
+// digits are lost.
+func (dv DecimalValue) Round(scale int, mode RoundingMode) DecimalValue {
+	if scale >= dv.Scale {
+		return NewDecimal(new(big.Int).Mul(dv.Unscaled, pow10(scale-dv.Scale)), scale)
+	}
+	return NewDecimal(quoRound(dv.Unscaled, pow10(dv.Scale-scale), mode), scale)
+}
+
+// Trim removes trailing zeros from the fraction without going below
+// minScale.
+func (dv DecimalValue) Trim(minScale int) DecimalValue {
+	unscaled, scale := new(big.Int).Set(dv.Unscaled), dv.Scale
+	ten, r := big.NewInt(10), new(big.Int)
+	for scale > minScale {
+		q, _ := new(big.Int).QuoRem(unscaled, ten, r)
+		if r.Sign() != 0 {
+			break
+		}
+		unscaled, scale = q, scale-1
+	}
+	return NewDecimal(unscaled, scale)
+}
+
+// quoRound returns n ÷ d rounded to an integer using mode.
+func quoRound(n, d *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	sign := int64(n.Sign() * d.Sign())
+	// half compares the remainder to half the divisor
+	twice := new(big.Int).Abs(r)
+	half := twice.Lsh(twice, 1).Cmp(new(big.Int).Abs(d))
+	var away bool
+	switch mode {
+	case Up:
+		away = true
+	case Ceiling:
+		away = sign > 0
+	case Floor:
+		away = sign < 0
+	case HalfUp:
+		away = half >= 0
+	case HalfDown:
+		away = half > 0
+	case HalfEven:
+		away = half > 0 || (half == 0 && q.Bit(0) == 1)
+	}
+	if away {
+		q.Add(q, big.NewInt(sign))
+	}
+	return q
+}
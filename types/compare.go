@@ -0,0 +1,234 @@
+package types
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// Equal reports whether a and b are the same value. Numbers are equal when
+// their values are whatever their types, so 1 equals 1.0, but NaN equals
+// nothing, itself included. Slices and blobs are equal when their elements
+// are in order, maps when they hold equal values under the same keys in any
+// order. Quotations and pipes are only equal to themselves.
+func Equal(a, b Value) bool {
+	var c comparer
+	return c.equal(a, b)
+}
+
+// Compare returns -1, 0 or 1 as a is less than, equal to or greater than b.
+// Numbers are ordered by value, strings byte by byte, bytes by value and bools
+// with false first. Slices and blobs are ordered by their first differing
+// element, or by length if one is the start of the other. ordered is false if
+// a and b can't be ordered: they are of different types, other than two
+// numbers, of a type with no order, or NaN is compared, at any depth.
+func Compare(a, b Value) (c int, ordered bool) {
+	var cmp comparer
+	return cmp.compare(a, b)
+}
+
+// Ordered reports whether values of type t can be ordered by Compare.
+func Ordered(t ValueType) bool {
+	switch t {
+	case ValueNum, ValueInt, ValueBigInt, ValueDecimal, ValueString, ValueByte, ValueBool, ValueSlice, ValueBlob:
+		return true
+	}
+	return false
+}
+
+// comparer keeps track of the pairs of slices and maps being compared, so a
+// slice that contains itself doesn't recurse forever. A pair met again while
+// it is still being compared is taken to be equal.
+type comparer struct {
+	seen map[[2]Value]bool
+}
+
+func (c *comparer) enter(a, b Value) bool {
+	if c.seen == nil {
+		c.seen = make(map[[2]Value]bool)
+	}
+	k := [2]Value{a, b}
+	if c.seen[k] {
+		return false
+	}
+	c.seen[k] = true
+	return true
+}
+
+func (c *comparer) leave(a, b Value) { delete(c.seen, [2]Value{a, b}) }
+
+func (c *comparer) equal(a, b Value) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	switch x := a.(type) {
+	case Number:
+		y, ok := b.(Number)
+		if !ok {
+			return false
+		}
+		n, ordered := CompareNumbers(x, y)
+		return ordered && n == 0
+	case StringValue:
+		y, ok := b.(StringValue)
+		return ok && x.Val == y.Val
+	case ByteValue:
+		y, ok := b.(ByteValue)
+		return ok && x.Val == y.Val
+	case BoolValue:
+		y, ok := b.(BoolValue)
+		return ok && x.Val == y.Val
+	case RefValue:
+		y, ok := b.(RefValue)
+		return ok && x.Key == y.Key
+	case *BlobValue:
+		y, ok := b.(*BlobValue)
+		return ok && bytes.Equal(x.Val, y.Val)
+	case *SliceValue:
+		y, ok := b.(*SliceValue)
+		if !ok || len(x.Val) != len(y.Val) {
+			return false
+		}
+		if x == y || !c.enter(x, y) {
+			return true
+		}
+		defer c.leave(x, y)
+		for i := range x.Val {
+			if !c.equal(x.Val[i], y.Val[i]) {
+				return false
+			}
+		}
+		return true
+	case *MapValue:
+		y, ok := b.(*MapValue)
+		if !ok || x.Len() != y.Len() {
+			return false
+		}
+		if x == y || !c.enter(x, y) {
+			return true
+		}
+		defer c.leave(x, y)
+		for i, k := range x.keys {
+			v, ok := y.Get(k)
+			if !ok || !c.equal(x.vals[i], v) {
+				return false
+			}
+		}
+		return true
+	case QuotationValue:
+		y, ok := b.(QuotationValue)
+		return ok && sameCode(x.Code, y.Code)
+	}
+	// pipes and anything else are compared by identity
+	return a == b
+}
+
+// sameCode reports whether two quotations hold the same code, without
+// panicking on code of a type that can't be compared with ==.
+func sameCode(a, b interface{}) bool {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || a == nil || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+func (c *comparer) compare(a, b Value) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	switch x := a.(type) {
+	case Number:
+		if y, ok := b.(Number); ok {
+			return CompareNumbers(x, y)
+		}
+	case StringValue:
+		if y, ok := b.(StringValue); ok {
+			return strings.Compare(x.Val, y.Val), true
+		}
+	case ByteValue:
+		if y, ok := b.(ByteValue); ok {
+			return cmpInt(int64(x.Val), int64(y.Val)), true
+		}
+	case BoolValue:
+		if y, ok := b.(BoolValue); ok {
+			return cmpInt(boolInt(x.Val), boolInt(y.Val)), true
+		}
+	case *BlobValue:
+		if y, ok := b.(*BlobValue); ok {
+			return bytes.Compare(x.Val, y.Val), true
+		}
+	case *SliceValue:
+		if y, ok := b.(*SliceValue); ok {
+			if x == y || !c.enter(x, y) {
+				return 0, true
+			}
+			defer c.leave(x, y)
+			for i := 0; i < len(x.Val) && i < len(y.Val); i++ {
+				if n, ordered := c.compare(x.Val[i], y.Val[i]); !ordered || n != 0 {
+					return n, ordered
+				}
+			}
+			return cmpInt(int64(len(x.Val)), int64(len(y.Val))), true
+		}
+	}
+	return 0, false
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// CompareNumbers returns -1, 0 or 1 as a is less than, equal to or greater
+// than b. Comparisons are exact whatever the types, ordered is false if
+// either is NaN.
+func CompareNumbers(a, b Number) (c int, ordered bool) {
+	x, xInt := a.(IntValue)
+	y, yInt := b.(IntValue)
+	if xInt && yInt {
+		return cmpInt(x.Val, y.Val), true
+	}
+	if ra, rb := toRat(a), toRat(b); ra != nil && rb != nil {
+		return ra.Cmp(rb), true
+	}
+	// infinities and NaN
+	fa, fb := a.Float(), b.Float()
+	switch {
+	case fa < fb:
+		return -1, true
+	case fa > fb:
+		return 1, true
+	case fa == fb:
+		return 0, true
+	}
+	return 0, false
+}
+
+// toRat returns n exactly as a rational, or nil if n is a float that is not
+// finite.
+func toRat(n Number) *big.Rat {
+	switch v := n.(type) {
+	case NumValue:
+		return new(big.Rat).SetFloat64(v.Val)
+	case IntValue:
+		return new(big.Rat).SetInt64(v.Val)
+	case BigIntValue:
+		return new(big.Rat).SetInt(v.Val)
+	case DecimalValue:
+		return v.Rat()
+	}
+	return new(big.Rat).SetFloat64(n.Float())
+}
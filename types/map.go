@@ -0,0 +1,171 @@
+package types
+
+import (
+	"math"
+	"math/big"
+	"strings"
+)
+
+// MapValue maps keys to values. Iteration is in the order keys were first
+// inserted. Keys may be strings, bytes, bools or numbers, numbers that are
+// equal refer to the same entry whatever their type so 1 and 1.0 are the
+// same key.
+type MapValue struct {
+	ValueType
+	keys  []Value
+	vals  []Value
+	index map[interface{}]int
+}
+
+func NewMap() *MapValue { return &MapValue{ValueType: ValueMap, index: make(map[interface{}]int)} }
+
+// Value returns the map itself, use Equal to compare maps by content.
+func (mv *MapValue) Value() interface{} { return mv }
+
+func (mv *MapValue) String() string { return mv.format(nil) }
+
+func (mv *MapValue) format(seen map[Value]bool) string {
+	if seen[mv] {
+		return "<cycle>"
+	}
+	if seen == nil {
+		seen = make(map[Value]bool)
+	}
+	seen[mv] = true
+	defer delete(seen, mv)
+	var b strings.Builder
+	b.WriteString("#{")
+	for i, k := range mv.keys {
+		b.WriteString(" " + format(k, seen) + " " + format(mv.vals[i], seen))
+	}
+	b.WriteString(" }")
+	return b.String()
+}
+
+func (mv *MapValue) Len() int { return len(mv.keys) }
+
+// Get returns the value stored under k.
+func (mv *MapValue) Get(k Value) (Value, bool) {
+	i, ok := mv.find(k)
+	if !ok {
+		return nil, false
+	}
+	return mv.vals[i], true
+}
+
+// Index returns the value stored under k, or nil.
+func (mv *MapValue) Index(k Value) Value {
+	v, _ := mv.Get(k)
+	return v
+}
+
+// Put stores v under k, reporting false if k is not a valid key.
+func (mv *MapValue) Put(k, v Value) bool {
+	key, ok := mapKey(k)
+	if !ok {
+		return false
+	}
+	if i, ok := mv.index[key]; ok {
+		mv.vals[i] = v
+		return true
+	}
+	mv.index[key] = len(mv.keys)
+	mv.keys = append(mv.keys, k)
+	mv.vals = append(mv.vals, v)
+	return true
+}
+
+// Delete removes the entry for k, reporting whether there was one.
+func (mv *MapValue) Delete(k Value) bool {
+	i, ok := mv.find(k)
+	if !ok {
+		return false
+	}
+	key, _ := mapKey(k)
+	delete(mv.index, key)
+	mv.keys = append(mv.keys[:i], mv.keys[i+1:]...)
+	mv.vals = append(mv.vals[:i], mv.vals[i+1:]...)
+	for j := i; j < len(mv.keys); j++ {
+		key, _ := mapKey(mv.keys[j])
+		mv.index[key] = j
+	}
+	return true
+}
+
+// Keys returns the keys of the map in order. The slice must not be modified.
+func (mv *MapValue) Keys() []Value { return mv.keys }
+
+// Values returns the values of the map in the order of their keys. The slice
+// must not be modified.
+func (mv *MapValue) Values() []Value { return mv.vals }
+
+// Iter calls f with each entry of the map as a { key value } slice. The
+// entries are those the map held when Iter was called.
+func (mv *MapValue) Iter(f func(Value) bool) {
+	// iterate over copies, f may change the map
+	keys := append([]Value(nil), mv.keys...)
+	vals := append([]Value(nil), mv.vals...)
+	for i, k := range keys {
+		if !f(&SliceValue{ValueSlice, []Value{k, vals[i]}}) {
+			return
+		}
+	}
+}
+
+func (mv *MapValue) find(k Value) (int, bool) {
+	key, ok := mapKey(k)
+	if !ok {
+		return 0, false
+	}
+	i, ok := mv.index[key]
+	return i, ok
+}
+
+// KeyTypes are the types of value that can be map keys.
+var KeyTypes = []ValueType{ValueString, ValueByte, ValueBool, ValueInt, ValueNum, ValueBigInt, ValueDecimal}
+
+// ValidKey reports whether v can be used as a map key, NaN and infinite
+// floats can't.
+func ValidKey(v Value) bool {
+	_, ok := mapKey(v)
+	return ok
+}
+
+// ratKey is the key of a number that is not a whole int64.
+type ratKey string
+
+// mapKey returns the Go map key for a key value. Whole numbers that fit in
+// an int64 are keyed by int64 and others by their exact fraction, so equal
+// numbers have equal keys whatever their type.
+func mapKey(v Value) (interface{}, bool) {
+	switch k := v.(type) {
+	case StringValue:
+		return k.Val, true
+	case ByteValue:
+		return k.Val, true
+	case BoolValue:
+		return k.Val, true
+	case IntValue:
+		return k.Val, true
+	case BigIntValue:
+		if k.Val.IsInt64() {
+			return k.Val.Int64(), true
+		}
+		return ratKey(k.Val.String()), true
+	case NumValue:
+		if math.IsNaN(k.Val) || math.IsInf(k.Val, 0) {
+			return nil, false
+		}
+		return ratMapKey(new(big.Rat).SetFloat64(k.Val)), true
+	case DecimalValue:
+		return ratMapKey(k.Rat()), true
+	}
+	return nil, false
+}
+
+func ratMapKey(r *big.Rat) interface{} {
+	if r.IsInt() && r.Num().IsInt64() {
+		return r.Num().Int64()
+	}
+	return ratKey(r.RatString())
+}
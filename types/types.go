@@ -1,8 +1,13 @@
 package types
 
 import (
+	"bufio"
 	"fmt"
 	"io"
+	"net"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 type Value interface {
@@ -22,10 +27,55 @@ const (
 	ValueBool
 	ValueRef
 	ValuePipe
+	ValueInt
+	ValueBigInt
+	ValueDecimal
+	ValueQuotation
+	ValueMap
+	ValueLines
+	ValueListener
+	ValueNil
 )
 
 func (vt ValueType) Type() ValueType { return vt }
 
+var typeNames = [...]string{
+	ValueNum:       "num",
+	ValueString:    "string",
+	ValueByte:      "byte",
+	ValueList:      "list",
+	ValueSlice:     "slice",
+	ValueBlob:      "blob",
+	ValueBool:      "bool",
+	ValueRef:       "ref",
+	ValuePipe:      "pipe",
+	ValueInt:       "int",
+	ValueBigInt:    "bigint",
+	ValueDecimal:   "decimal",
+	ValueQuotation: "quotation",
+	ValueMap:       "map",
+	ValueLines:     "lines",
+	ValueListener:  "listener",
+	ValueNil:       "nil",
+}
+
+// TypeOf returns the type of v, or ValueNil if v is nil, as @ pushes for a
+// variable that was never stored to.
+func TypeOf(v Value) ValueType {
+	if v == nil {
+		return ValueNil
+	}
+	return v.Type()
+}
+
+// Name returns the name scripts know the type by.
+func (vt ValueType) Name() string {
+	if vt < 0 || int(vt) >= len(typeNames) {
+		return "unknown"
+	}
+	return typeNames[vt]
+}
+
 type NumValue struct {
 	ValueType
 	Val float64
@@ -35,8 +85,32 @@ func (nv NumValue) Value() interface{} { return nv.Val }
 
 func (nv NumValue) String() string { return fmt.Sprintf("%v", nv.Val) }
 
+func (nv NumValue) Float() float64 { return nv.Val }
+
 func NewNum(n float64) NumValue { return NumValue{ValueNum, n} }
 
+// IntValue is a 64-bit signed integer. Arithmetic on integers wraps around on
+// overflow.
+type IntValue struct {
+	ValueType
+	Val int64
+}
+
+func (iv IntValue) Value() interface{} { return iv.Val }
+
+func (iv IntValue) String() string { return strconv.FormatInt(iv.Val, 10) }
+
+func (iv IntValue) Float() float64 { return float64(iv.Val) }
+
+func NewInt(n int64) IntValue { return IntValue{ValueInt, n} }
+
+// Number is implemented by the numeric types, Float returns the value as a
+// float64 for arithmetic mixing them.
+type Number interface {
+	Value
+	Float() float64
+}
+
 type Sizer interface {
 	Len() int
 }
@@ -50,7 +124,25 @@ func (sv StringValue) Value() interface{} { return sv.Val }
 
 func (sv StringValue) String() string { return sv.Val }
 
-func (sv StringValue) Len() int { return len(sv.Val) }
+// Len returns the number of characters, not bytes, in the string.
+func (sv StringValue) Len() int { return utf8.RuneCountInString(sv.Val) }
+
+// Index returns the character at a character index, as a string, or the
+// characters in a { start end } range.
+func (sv StringValue) Index(v Value) Value {
+	r := []rune(sv.Val)
+	switch n := v.(type) {
+	case Number:
+		return NewString(string(r[int(n.Float())]))
+	case *SliceValue:
+		start, end, ok := indexRange(n)
+		if !ok {
+			return nil
+		}
+		return NewString(string(r[start:end]))
+	}
+	return nil
+}
 
 func NewString(s string) StringValue { return StringValue{ValueString, s} }
 
@@ -61,6 +153,9 @@ type ByteValue struct {
 
 func (bv ByteValue) Value() interface{} { return bv.Val }
 
+// String returns the byte itself as a one byte string.
+func (bv ByteValue) String() string { return string([]byte{bv.Val}) }
+
 func NewByte(n byte) ByteValue { return ByteValue{ValueByte, n} }
 
 type BoolValue struct {
@@ -85,6 +180,41 @@ func (rv RefValue) String() string { return rv.Key }
 
 func NewRef(k string) RefValue { return RefValue{ValueRef, k} }
 
+// QuotationValue is a block of code, written [ ... ], that can be called
+// like a word. Code is whatever the interpreter that created it needs to run
+// it, this package only prints it.
+type QuotationValue struct {
+	ValueType
+	Code fmt.Stringer
+}
+
+func (qv QuotationValue) Value() interface{} { return qv.Code }
+
+func (qv QuotationValue) String() string { return qv.Code.String() }
+
+func NewQuotation(code fmt.Stringer) QuotationValue { return QuotationValue{ValueQuotation, code} }
+
+// Format returns v as . prints it: with its String method, or as <nil> or
+// the name of its type in angle brackets, such as <pipe>, if it has none.
+func Format(v Value) string { return format(v, nil) }
+
+// format returns v as it is printed inside a slice or map. seen holds the
+// slices and maps being printed, one met again inside itself prints as
+// <cycle> rather than recursing forever.
+func format(v Value, seen map[Value]bool) string {
+	switch c := v.(type) {
+	case *SliceValue:
+		return c.format(seen)
+	case *MapValue:
+		return c.format(seen)
+	case nil:
+		return "<nil>"
+	case fmt.Stringer:
+		return c.String()
+	}
+	return "<" + v.Type().Name() + ">"
+}
+
 type Collection interface {
 	Value
 	Insert(Value)
@@ -101,26 +231,61 @@ type SliceValue struct {
 
 func (vv *SliceValue) Value() interface{} { return vv.Val }
 
+func (vv *SliceValue) String() string { return vv.format(nil) }
+
+func (vv *SliceValue) format(seen map[Value]bool) string {
+	if seen[vv] {
+		return "<cycle>"
+	}
+	if seen == nil {
+		seen = make(map[Value]bool)
+	}
+	seen[vv] = true
+	defer delete(seen, vv)
+	var b strings.Builder
+	b.WriteString("{")
+	for _, v := range vv.Val {
+		b.WriteString(" " + format(v, seen))
+	}
+	b.WriteString(" }")
+	return b.String()
+}
+
 func (vv *SliceValue) Insert(v Value) { vv.Val = append(vv.Val, v) }
 
 func (vv *SliceValue) Index(v Value) Value {
 	switch n := v.(type) {
-	case NumValue:
-		return vv.Val[int(n.Val)]
+	case Number:
+		return vv.Val[int(n.Float())]
 	case *SliceValue:
-		if len(n.Val) < 2 {
+		start, end, ok := indexRange(n)
+		if !ok {
 			return nil
 		}
-		start, _ := n.Val[0].(NumValue)
-		end, _ := n.Val[1].(NumValue)
 		return &SliceValue{
 			ValueSlice,
-			vv.Val[int(start.Val):int(end.Val)],
+			vv.Val[start:end],
 		}
 	}
 	return nil
 }
 
+// indexRange returns the start and end of a { start end } range.
+func indexRange(r *SliceValue) (int, int, bool) {
+	if len(r.Val) < 2 {
+		return 0, 0, false
+	}
+	start, ok := r.Val[0].(Number)
+	if !ok {
+		return 0, 0, false
+	}
+	end, ok := r.Val[1].(Number)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(start.Float()), int(end.Float()), true
+}
+
 func (vv *SliceValue) Len() int { return len(vv.Val) }
 
 type BlobValue struct {
@@ -140,33 +305,65 @@ func (bv *BlobValue) Insert(v Value) {
 
 func (bv *BlobValue) Index(v Value) Value {
 	switch n := v.(type) {
-	case NumValue:
-		return ByteValue{ValueByte, bv.Val[int(n.Val)]}
+	case Number:
+		return ByteValue{ValueByte, bv.Val[int(n.Float())]}
 	case *SliceValue:
-		if len(n.Val) < 2 {
+		start, end, ok := indexRange(n)
+		if !ok {
 			return nil
 		}
-		start, _ := n.Val[0].(NumValue)
-		end, _ := n.Val[1].(NumValue)
-		return &BlobValue{ValueBlob, bv.Val[int(start.Val):int(end.Val)]}
+		return &BlobValue{ValueBlob, bv.Val[start:end]}
 	}
 	return nil
 }
 
+// Iterable is implemented by values with elements that can be visited in
+// order. Iter calls f with each element until f returns false.
 type Iterable interface {
-	Iter(Value)
+	Iter(f func(Value) bool)
+}
+
+func (vv *SliceValue) Iter(f func(Value) bool) {
+	for _, v := range vv.Val {
+		if !f(v) {
+			return
+		}
+	}
+}
+
+func (bv *BlobValue) Iter(f func(Value) bool) {
+	for _, b := range bv.Val {
+		if !f(NewByte(b)) {
+			return
+		}
+	}
 }
 
+// Iter calls f with each character of the string, as a string.
+func (sv StringValue) Iter(f func(Value) bool) {
+	for _, r := range sv.Val {
+		if !f(NewString(string(r))) {
+			return
+		}
+	}
+}
+
+// PipeValue is a file or connection. Reads go through a buffer, so the
+// different ways of reading a pipe can be mixed.
 type PipeValue struct {
 	ValueType
 	Val io.ReadWriteCloser
+	r   *bufio.Reader
 }
 
+func NewPipe(rwc io.ReadWriteCloser) *PipeValue { return &PipeValue{ValueType: ValuePipe, Val: rwc} }
+
 func (pv *PipeValue) Value() interface{} { return pv.Val }
 
 func (pv *PipeValue) Type() ValueType { return pv.ValueType }
 
-func (fp *PipeValue) Write(v Value) (float64, error) {
+// Write writes a string or blob to the pipe.
+func (pv *PipeValue) Write(v Value) (int, error) {
 	var b []byte
 	switch p := v.(type) {
 	case StringValue:
@@ -174,12 +371,81 @@ func (fp *PipeValue) Write(v Value) (float64, error) {
 	case *BlobValue:
 		b = p.Val
 	}
-	n, err := fp.Val.Write(b)
-	return float64(n), err
+	return pv.Val.Write(b)
+}
+
+func (pv *PipeValue) reader() *bufio.Reader {
+	if pv.r == nil {
+		pv.r = bufio.NewReader(pv.Val)
+	}
+	return pv.r
 }
 
-func (pv *PipeValue) Read(b []byte) (float64, error) {
-	return 0, nil
+// Read reads up to len(b) bytes from the pipe.
+func (pv *PipeValue) Read(b []byte) (int, error) { return pv.reader().Read(b) }
+
+// ReadLine reads up to and including the next newline and returns the line
+// without it, or a carriage return before it. The last line need not end
+// with a newline, io.EOF is returned only when there is nothing left to read.
+func (pv *PipeValue) ReadLine() (string, error) {
+	line, err := pv.reader().ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), err
+}
+
+// ReadByte reads a single byte from the pipe.
+func (pv *PipeValue) ReadByte() (byte, error) { return pv.reader().ReadByte() }
+
+func (pv *PipeValue) Close() error { return pv.Val.Close() }
+
+// ListenerValue is a network listener, accepting connections as pipes.
+type ListenerValue struct {
+	ValueType
+	Val net.Listener
+}
+
+func NewListener(l net.Listener) *ListenerValue { return &ListenerValue{ValueListener, l} }
+
+func (lv *ListenerValue) Value() interface{} { return lv.Val }
+
+// Accept waits for the next connection to the listener.
+func (lv *ListenerValue) Accept() (*PipeValue, error) {
+	conn, err := lv.Val.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewPipe(conn), nil
+}
+
+func (lv *ListenerValue) Close() error { return lv.Val.Close() }
+
+// LinesValue is the lines of a pipe, read one at a time as they are iterated
+// over, so iterating again carries on from where the last iteration stopped.
+// Err is the error, other than io.EOF, that ended iteration early.
+type LinesValue struct {
+	ValueType
+	Pipe *PipeValue
+	Err  error
 }
 
-func (fp *PipeValue) Close() error { return fp.Val.Close() }
+func NewLines(p *PipeValue) *LinesValue { return &LinesValue{ValueType: ValueLines, Pipe: p} }
+
+func (lv *LinesValue) Value() interface{} { return lv.Pipe }
+
+func (lv *LinesValue) Iter(f func(Value) bool) {
+	for {
+		line, err := lv.Pipe.ReadLine()
+		if err != nil {
+			if err != io.EOF {
+				lv.Err = err
+			}
+			return
+		}
+		if !f(NewString(line)) {
+			return
+		}
+	}
+}